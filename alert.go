@@ -0,0 +1,89 @@
+package main
+
+import (
+	"time"
+
+	bn "github.com/larskluge/babl/bablnaming"
+)
+
+// AlertVersion of the Alert document, bumped on incompatible changes
+const AlertVersion = 1
+
+// Alert structured, versioned document describing a notification, e.g. as produced to logs.alerts
+type Alert struct {
+	Version   int            `json:"version"`
+	Class     string         `json:"class"`
+	Rule      string         `json:"rule,omitempty"`
+	Severity  string         `json:"severity"`
+	Cluster   string         `json:"cluster"`
+	Service   string         `json:"service,omitempty"`
+	Module    string         `json:"module,omitempty"`
+	Task      string         `json:"task,omitempty"`
+	Node      string         `json:"node,omitempty"`
+	Image     string         `json:"image,omitempty"`
+	Status    string         `json:"status,omitempty"`
+	ExitCode  string         `json:"exit_code,omitempty"`
+	ExitClass string         `json:"exit_class,omitempty"`
+	Message   string         `json:"message"`
+	Services  []string       `json:"services,omitempty"`
+	Counts    map[string]int `json:"counts,omitempty"`
+	Incident  *Incident      `json:"incident,omitempty"`
+	Members   int            `json:"members,omitempty"`
+	EventTime time.Time      `json:"event_time"`
+	Time      time.Time      `json:"time"`
+	Origin    *EventOrigin   `json:"origin,omitempty"`
+}
+
+// EventOrigin where an event was read from
+type EventOrigin struct {
+	Source    string `json:"source"`
+	Topic     string `json:"topic,omitempty"`
+	Partition int32  `json:"partition"`
+	Offset    int64  `json:"offset"`
+}
+
+// NewAlert describes n as Alert
+func NewAlert(n *Notification) *Alert {
+	m := n.Event
+	a := m.Actor.Attributes
+	alert := &Alert{
+		Version:   AlertVersion,
+		Class:     n.Class,
+		Rule:      n.Rule,
+		Severity:  n.Severity,
+		Cluster:   n.Cluster,
+		Service:   a.ComDockerSwarmServiceName,
+		Task:      a.ComDockerSwarmTaskName,
+		Node:      m.NodeID(),
+		Image:     a.Image,
+		Status:    m.Status,
+		ExitCode:  a.ExitCode,
+		ExitClass: m.ExitClass,
+		Message:   n.Message,
+		Services:  n.Services,
+		Counts:    n.Counts,
+		Incident:  n.Incident,
+		Members:   len(n.Members),
+		EventTime: eventTime(m),
+		Time:      time.Now(),
+		Origin:    m.Origin,
+	}
+	if alert.Service != "" {
+		alert.Module = bn.ServiceToModule(alert.Service)
+	}
+	if m.Status == "" {
+		alert.Status = m.Action
+	}
+	return alert
+}
+
+// Key partitions alerts by service, falling back to the node for node alerts
+func (a *Alert) Key() string {
+	if a.Service != "" {
+		return a.Service
+	}
+	if a.Node != "" {
+		return "node." + a.Node
+	}
+	return a.Cluster
+}
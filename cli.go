@@ -9,7 +9,32 @@ func configureCli() (app *cli.App) {
 	app.Usage = "Sentinel"
 	app.Version = Version
 	app.Action = func(c *cli.Context) {
-		run(c.String("kafka-brokers"), c.GlobalBool("debug"))
+		run(options(c))
+	}
+	app.Commands = []cli.Command{
+		{
+			Name:  "replay",
+			Usage: "Replay recorded Docker events (JSON lines) through the rules and notifiers",
+			Action: func(c *cli.Context) {
+				o := options(c)
+				o.Source = "replay"
+				o.ReplayFile = c.String("file")
+				o.ReplaySpeed = c.String("speed")
+				run(o)
+			},
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "file, f",
+					Usage: "JSON lines file of Docker events, - reads stdin",
+					Value: "-",
+				},
+				cli.StringFlag{
+					Name:  "speed",
+					Usage: "Replay speed relative to the recorded timeNano spacing, e.g. 10x, or max",
+					Value: "max",
+				},
+			},
+		},
 	}
 	app.Flags = []cli.Flag{
 		cli.StringFlag{
@@ -17,6 +42,57 @@ func configureCli() (app *cli.App) {
 			Usage: "Comma separated list of kafka brokers",
 			Value: "127.0.0.1:9092",
 		},
+		cli.StringFlag{
+			Name:   "cluster",
+			Usage:  "Name of the cluster, derived from the first Kafka broker when empty; ignored when the config lists clusters",
+			EnvVar: "SENTINEL_CLUSTER",
+		},
+		cli.StringFlag{
+			Name:  "source",
+			Usage: "Where Docker events are read from: kafka or docker",
+			Value: "kafka",
+		},
+		cli.StringFlag{
+			Name:   "docker-host",
+			Usage:  "Docker daemon streaming events for --source docker, unix:// or tcp://",
+			Value:  "unix:///var/run/docker.sock",
+			EnvVar: "DOCKER_HOST",
+		},
+		cli.StringFlag{
+			Name:  "group",
+			Usage: "Kafka consumer group used to commit offsets of " + TopicEvents,
+			Value: "sentinel",
+		},
+		cli.StringFlag{
+			Name:   "config",
+			Usage:  "YAML config of notifiers and their routes per event class",
+			EnvVar: "SENTINEL_CONFIG",
+		},
+		cli.StringFlag{
+			Name:   "rules",
+			Usage:  "YAML file of rules selecting which events trigger which actions",
+			EnvVar: "SENTINEL_RULES",
+		},
+		cli.StringFlag{
+			Name:   "http-addr",
+			Usage:  "Serve /metrics, /healthz, /readyz, /services and /dry-run on this address, e.g. :9100",
+			EnvVar: "SENTINEL_HTTP_ADDR",
+		},
+		cli.StringFlag{
+			Name:   "alerts-topic",
+			Usage:  "Also produce every notification as structured JSON alert to this Kafka topic, e.g. " + TopicAlerts,
+			EnvVar: "SENTINEL_ALERTS_TOPIC",
+		},
+		cli.BoolFlag{
+			Name:   "dry-run",
+			Usage:  "Record notifications instead of sending them, see /dry-run; consumes with the group <group>-dry-run and leaves the retry outbox and dead-letter topic alone",
+			EnvVar: "SENTINEL_DRY_RUN",
+		},
+		cli.IntFlag{
+			Name:  "dry-run-keep",
+			Usage: "Number of recorded notifications kept for /dry-run",
+			Value: 100,
+		},
 		cli.BoolFlag{
 			Name:   "debug",
 			Usage:  "Enable debug mode & verbose logging",
@@ -25,3 +101,21 @@ func configureCli() (app *cli.App) {
 	}
 	return
 }
+
+// options collects the global flags, also from within a subcommand
+func options(c *cli.Context) Options {
+	return Options{
+		KafkaBrokers: c.GlobalString("kafka-brokers"),
+		Cluster:      c.GlobalString("cluster"),
+		Group:        c.GlobalString("group"),
+		Source:       c.GlobalString("source"),
+		DockerHost:   c.GlobalString("docker-host"),
+		ConfigPath:   c.GlobalString("config"),
+		RulesPath:    c.GlobalString("rules"),
+		HTTPAddr:     c.GlobalString("http-addr"),
+		AlertsTopic:  c.GlobalString("alerts-topic"),
+		DryRun:       c.GlobalBool("dry-run"),
+		DryRunKeep:   c.GlobalInt("dry-run-keep"),
+		Debug:        c.GlobalBool("debug"),
+	}
+}
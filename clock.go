@@ -0,0 +1,35 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// EventClock time as seen by the events of a source: the latest event time, advanced by the
+// wall time since that event was handled. Housekeeping driven by it behaves the same when events
+// arrive live, when a restarted consumer catches up, or when a recording is replayed.
+type EventClock struct {
+	mu      sync.Mutex
+	latest  time.Time
+	handled time.Time
+}
+
+// Advance moves the clock to the time of an event, events older than the latest one are ignored
+func (c *EventClock) Advance(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !t.Before(c.latest) {
+		c.latest = t
+		c.handled = time.Now()
+	}
+}
+
+// Now the current time of the clock, the wall time until the first event
+func (c *EventClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.latest.IsZero() {
+		return time.Now()
+	}
+	return c.latest.Add(time.Since(c.handled))
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("EventClock", func() {
+	It("follows the latest event time", func() {
+		c := &EventClock{}
+		Expect(c.Now()).To(BeTemporally("~", time.Now(), time.Second))
+		at := time.Unix(1500000000, 0)
+		c.Advance(at)
+		Expect(c.Now()).To(BeTemporally("~", at, time.Second))
+		c.Advance(at.Add(-time.Hour))
+		Expect(c.Now()).To(BeTemporally("~", at, time.Second))
+		c.Advance(at.Add(24 * time.Hour))
+		Expect(c.Now()).To(BeTemporally("~", at.Add(24*time.Hour), time.Second))
+	})
+})
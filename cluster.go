@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	. "github.com/larskluge/babl-server/utils"
+)
+
+// ClusterConfig one Swarm cluster watched by sentinel
+type ClusterConfig struct {
+	Name     string   `yaml:"name"`
+	Brokers  []string `yaml:"brokers"`
+	Topic    string   `yaml:"topic"`    // defaults to TopicEvents
+	Group    string   `yaml:"group"`    // defaults to --group
+	Endpoint string   `yaml:"endpoint"` // babl endpoint of the cluster, defaults to <name>.babl.sh:4445
+}
+
+// withDefaults fills the optional settings of c
+func (c ClusterConfig) withDefaults(group string) ClusterConfig {
+	if c.Topic == "" {
+		c.Topic = TopicEvents
+	}
+	if c.Group == "" {
+		c.Group = group
+	}
+	if c.Endpoint == "" {
+		c.Endpoint = c.Name + ".babl.sh:4445"
+	}
+	return c
+}
+
+// ClusterName derives the cluster name from the brokers unless given explicitly,
+// e.g. "production" for production.babl.sh:9092
+func ClusterName(name, kafkaBrokers string) string {
+	if name != "" {
+		return name
+	}
+	host := SplitFirst(kafkaBrokers, ",")
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if net.ParseIP(host) != nil || !strings.Contains(host, ".") {
+		log.WithFields(log.Fields{"brokers": kafkaBrokers, "cluster": host}).Warn("Cluster name cannot be derived from brokers, set --cluster")
+		return host
+	}
+	return SplitFirst(host, ".")
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"io/ioutil"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	. "github.com/larskluge/babl-server/utils"
+	"gopkg.in/yaml.v2"
+)
+
+// Config sentinel configuration, usually loaded from a YAML file
+type Config struct {
+	Clusters   []ClusterConfig           `yaml:"clusters"`
+	Notifiers  map[string]NotifierConfig `yaml:"notifiers"`
+	Routes     map[string][]string       `yaml:"routes"`
+	Flapping   FlappingConfig            `yaml:"flapping"`
+	Grouping   GroupingConfig            `yaml:"grouping"`
+	Incidents  IncidentConfig            `yaml:"incidents"`
+	DeadLetter DeadLetterConfig          `yaml:"dead_letter"`
+	Retry      RetryConfig               `yaml:"retry"`
+}
+
+// NotifierConfig settings of a single notifier, which fields apply depends on Type
+type NotifierConfig struct {
+	Type string `yaml:"type"` // babl, kafka (alias alerts), webhook, slack, pagerduty, smtp, syslog, plugin or stdout
+
+	// Template text/template of the message delivered by this notifier, overriding the rule's, see MessageData
+	Template string `yaml:"template"`
+
+	// babl; endpoint, module and env values are templates of BablVars, the endpoint defaults to the cluster's
+	Bin      string            `yaml:"bin"`
+	Endpoint string            `yaml:"endpoint"`
+	Module   string            `yaml:"module"`
+	Env      map[string]string `yaml:"env"`
+
+	// kafka, alerts; brokers default to the ones events are consumed from
+	Brokers []string `yaml:"brokers"`
+	Topic   string   `yaml:"topic"`
+
+	// webhook; headers and timeout apply to all targets unless overridden per target
+	URL     string            `yaml:"url"`
+	Targets []WebhookTarget   `yaml:"targets"`
+	Headers map[string]string `yaml:"headers"`
+	Timeout time.Duration     `yaml:"timeout"`
+	Secret  string            `yaml:"secret"` // HMAC-SHA256 key signing each request
+
+	// slack; url of an incoming webhook, or a bot token and channel to thread alerts per service
+	Token   string `yaml:"token"`
+	Channel string `yaml:"channel"`
+
+	// pagerduty; url defaults to the Events API v2, min_severity of triggers to error
+	RoutingKey  string `yaml:"routing_key"`
+	MinSeverity string `yaml:"min_severity"`
+
+	// smtp; addr of the server, recipients per class override to, subject, text and html are templates of MailBatch
+	Addr       string              `yaml:"addr"`
+	StartTLS   bool                `yaml:"starttls"`
+	Username   string              `yaml:"username"`
+	Password   string              `yaml:"password"`
+	From       string              `yaml:"from"`
+	To         []string            `yaml:"to"`
+	Recipients map[string][]string `yaml:"recipients"`
+	Interval   time.Duration       `yaml:"interval"` // at most one mail per interval and recipient, default 5m
+	Subject    string              `yaml:"subject"`
+	Text       string              `yaml:"text"`
+	HTML       string              `yaml:"html"`
+
+	// syslog; addr is shared with smtp, network is udp, tcp or tls
+	Network  string `yaml:"network"`
+	Facility string `yaml:"facility"` // default daemon
+	Events   bool   `yaml:"events"`   // also forward every Docker event matched by a rule
+
+	// plugin; argv of the plugin process, env is added to its environment, see PluginNotifier
+	Command []string `yaml:"command"`
+}
+
+// DefaultConfig mirrors the behaviour of sentinel before notifiers were configurable
+func DefaultConfig() *Config {
+	return &Config{
+		Notifiers: map[string]NotifierConfig{
+			"babl-events": {
+				Type:     "babl",
+				Endpoint: "sandbox.babl.sh:4445",
+				Module:   "babl/events",
+				Env:      map[string]string{"EVENT": "babl:error"},
+			},
+			"babl-oom": {
+				Type:   "babl",
+				Module: "babl/events",
+				Env:    map[string]string{"EVENT": "babl:module:oom", "MODULE": "{{.MODULE}}", "INSTANCE_ID": "{{.INSTANCE_ID}}"},
+			},
+		},
+		Routes: map[string][]string{
+			ClassEvent:            {"babl-events"},
+			ClassOom:              {"babl-oom"},
+			ClassFlapping:         {"babl-events"},
+			ClassRecovered:        {"babl-events"},
+			ClassNode:             {"babl-events"},
+			ClassIncidentResolved: {"babl-events"},
+		},
+		Flapping: FlappingConfig{Threshold: 5, Window: 10 * time.Minute, Stable: 10 * time.Minute},
+	}
+}
+
+// alertsNotifier name of the notifier added by PublishAlerts
+const alertsNotifier = "alerts"
+
+// PublishAlerts produces every notification class as Alert to topic, in addition to the configured notifiers
+func (c *Config) PublishAlerts(topic string) {
+	c.Notifiers[alertsNotifier] = NotifierConfig{Type: "kafka", Topic: topic}
+	for _, class := range []string{ClassEvent, ClassOom, ClassFlapping, ClassRecovered, ClassNode, ClassIncidentOpened, ClassIncidentUpdated, ClassIncidentResolved, ClassUndeliverable} {
+		c.Routes[class] = append(c.Routes[class], alertsNotifier)
+	}
+}
+
+// DefaultBrokers sets brokers for all Kafka notifiers without brokers of their own
+func (c *Config) DefaultBrokers(brokers []string) {
+	for name, nc := range c.Notifiers {
+		if (nc.Type == "kafka" || nc.Type == "alerts") && len(nc.Brokers) == 0 {
+			nc.Brokers = brokers
+			c.Notifiers[name] = nc
+		}
+	}
+}
+
+// LoadConfig reads the YAML config at path, an empty path yields DefaultConfig
+func LoadConfig(path string) *Config {
+	if path == "" {
+		return DefaultConfig()
+	}
+	data, err := ioutil.ReadFile(path)
+	Check(err)
+	cfg := &Config{Notifiers: map[string]NotifierConfig{}, Routes: map[string][]string{}}
+	err = yaml.Unmarshal(data, cfg)
+	Check(err)
+	log.WithFields(log.Fields{"path": path, "notifiers": len(cfg.Notifiers), "routes": len(cfg.Routes)}).Info("Config loaded")
+	return cfg
+}
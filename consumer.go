@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Shopify/sarama"
+	log "github.com/Sirupsen/logrus"
+	"github.com/larskluge/babl-server/kafka"
+	"gopkg.in/bsm/sarama-cluster.v2"
+)
+
+// KafkaSource consumes all partitions of Topic of one cluster as member of a consumer group.
+// An offset is marked only after its event has been handled, so a restart resumes
+// from the last handled event instead of the newest one. Run stops at the first event
+// that cannot be handled, i.e. whose notifications could not be queued for delivery.
+// Messages which cannot be decoded as Event are parked in DeadLetters.
+type KafkaSource struct {
+	Cluster     string
+	Brokers     []string
+	Topic       string
+	Group       string
+	DeadLetters *DeadLetters
+}
+
+func (s *KafkaSource) Name() string {
+	return "kafka:" + s.Cluster
+}
+
+func (s *KafkaSource) Run(handle func(m Event) error) error {
+	client := kafka.NewClientGroup(s.Brokers, "sentinel", true)
+	defer client.Close()
+
+	consumer, err := cluster.NewConsumerFromClient(client, s.Group, []string{s.Topic})
+	if err != nil {
+		return err
+	}
+	defer consumer.Close()
+
+	go consumeErrors(consumer)
+	go s.consumeNotifications(consumer)
+
+	health.SetAlive(s.Name(), true)
+	defer health.SetAlive(s.Name(), false)
+	offsets := &handledOffsets{offsets: map[int32]int64{}}
+	go s.reportLag(client, offsets)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	log.WithFields(log.Fields{"cluster": s.Cluster, "topic": s.Topic, "group": s.Group}).Info("Consuming")
+	for {
+		select {
+		case msg, ok := <-consumer.Messages():
+			if !ok {
+				return nil
+			}
+			var m Event
+			if err := json.Unmarshal(msg.Value, &m); err != nil {
+				s.DeadLetters.Park(msg, "decode", err)
+				consumer.MarkOffset(msg, "")
+				continue
+			}
+			if m.Type == "" && m.Status == "" {
+				s.DeadLetters.Park(msg, "unexpected", fmt.Errorf("neither Type nor status set"))
+				consumer.MarkOffset(msg, "")
+				continue
+			}
+			m.Origin = &EventOrigin{Source: "kafka", Topic: msg.Topic, Partition: msg.Partition, Offset: msg.Offset}
+			log.WithFields(log.Fields{"cluster": s.Cluster, "broker": s.Brokers, "partition": msg.Partition, "offset": msg.Offset, "event": m}).Debug("Docker Event")
+			if err := handle(m); err != nil {
+				// leave the offset unmarked, a restart resumes with this event
+				return fmt.Errorf("kafka %s/%d@%d: %s", msg.Topic, msg.Partition, msg.Offset, err)
+			}
+			consumer.MarkOffset(msg, "")
+			offsets.Set(msg.Partition, msg.Offset)
+		case sig := <-signals:
+			log.WithFields(log.Fields{"signal": sig}).Info("Shutting down, committing offsets")
+			return nil
+		}
+	}
+}
+
+func consumeErrors(consumer *cluster.Consumer) {
+	for err := range consumer.Errors() {
+		log.WithFields(log.Fields{"error": err.Error()}).Warn("ConsumeGroup: Error")
+	}
+}
+
+func (s *KafkaSource) consumeNotifications(consumer *cluster.Consumer) {
+	for note := range consumer.Notifications() {
+		log.WithFields(log.Fields{"cluster": s.Cluster, "claimed": note.Claimed, "released": note.Released, "current": note.Current}).Info("ConsumeGroup: Rebalanced")
+		health.SetReady(s.Name(), len(note.Current[s.Topic]) > 0)
+	}
+}
+
+// handledOffsets last offset handled per partition
+type handledOffsets struct {
+	mu      sync.Mutex
+	offsets map[int32]int64
+}
+
+func (o *handledOffsets) Set(partition int32, offset int64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.offsets[partition] = offset
+}
+
+func (o *handledOffsets) Get() map[int32]int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	offsets := make(map[int32]int64, len(o.offsets))
+	for p, offset := range o.offsets {
+		offsets[p] = offset
+	}
+	return offsets
+}
+
+// reportLag periodically compares the handled offsets with the newest offset of each partition
+func (s *KafkaSource) reportLag(client *cluster.Client, offsets *handledOffsets) {
+	for range time.Tick(15 * time.Second) {
+		for partition, offset := range offsets.Get() {
+			newest, err := client.GetOffset(s.Topic, partition, sarama.OffsetNewest)
+			if err != nil {
+				log.WithFields(log.Fields{"cluster": s.Cluster, "partition": partition, "error": err}).Warn("Consumer lag: newest offset unknown")
+				continue
+			}
+			metrics.Set("sentinel_consumer_lag", Labels{"cluster": s.Cluster, "partition": fmt.Sprint(partition)}, float64(newest-offset-1))
+		}
+	}
+}
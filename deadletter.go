@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Shopify/sarama"
+	log "github.com/Sirupsen/logrus"
+	"github.com/larskluge/babl-server/kafka"
+)
+
+// DeadLetterConfig where messages of TopicEvents that cannot be handled are parked
+type DeadLetterConfig struct {
+	Topic   string   `yaml:"topic"`
+	Brokers []string `yaml:"brokers"` // defaults to the brokers events are consumed from
+}
+
+// DeadLetter a message of TopicEvents that could not be handled, as produced to the dead-letter topic
+type DeadLetter struct {
+	Topic     string    `json:"topic"`
+	Partition int32     `json:"partition"`
+	Offset    int64     `json:"offset"`
+	Key       string    `json:"key,omitempty"`
+	Value     string    `json:"value"`
+	Error     string    `json:"error"`
+	Reason    string    `json:"reason"`
+	Time      time.Time `json:"time"`
+}
+
+// DeadLetters produces undecodable or unexpected messages to a topic, without a topic they are only logged
+type DeadLetters struct {
+	topic    string
+	producer *sarama.SyncProducer
+}
+
+func NewDeadLetters(cfg DeadLetterConfig, brokers []string) *DeadLetters {
+	d := &DeadLetters{topic: cfg.Topic}
+	if cfg.Topic == "" {
+		return d
+	}
+	if len(cfg.Brokers) > 0 {
+		brokers = cfg.Brokers
+	}
+	d.producer = kafka.NewProducer(brokers, "sentinel")
+	return d
+}
+
+// Park records msg as dead letter, failures to do so are logged but never fatal
+func (d *DeadLetters) Park(msg *sarama.ConsumerMessage, reason string, err error) {
+	metrics.Inc("sentinel_dead_letters_total", Labels{"reason": reason})
+	fields := log.Fields{"topic": msg.Topic, "partition": msg.Partition, "offset": msg.Offset, "reason": reason, "error": err.Error()}
+	log.WithFields(fields).Warn("Dead letter")
+	if d.producer == nil {
+		return
+	}
+
+	value, _ := json.Marshal(DeadLetter{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Key:       string(msg.Key),
+		Value:     string(msg.Value),
+		Error:     err.Error(),
+		Reason:    reason,
+		Time:      time.Now(),
+	})
+	out := &sarama.ProducerMessage{Topic: d.topic, Value: sarama.ByteEncoder(value)}
+	if len(msg.Key) > 0 {
+		out.Key = sarama.ByteEncoder(msg.Key)
+	}
+	if _, _, err := (*d.producer).SendMessage(out); err != nil {
+		log.WithFields(fields).WithField("dead_letter_error", err.Error()).Error("Dead letter could not be produced")
+	}
+}
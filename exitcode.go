@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Exit classes of a container die event
+const (
+	ExitClean   = "clean"   // exit code 0, e.g. scale-down or a finished task
+	ExitError   = "error"   // any other non-zero exit code of the application
+	ExitSigkill = "sigkill" // 137, killed by SIGKILL
+	ExitSigterm = "sigterm" // 143, terminated by SIGTERM
+	ExitOom     = "oom"     // killed by the kernel OOM killer
+)
+
+// oomWindow how long after an oom event the die of the same container counts as OOM-killed
+const oomWindow = time.Minute
+
+// ExitClassifier classifies die events by exit code, remembering recent oom events per container
+type ExitClassifier struct {
+	mu   sync.Mutex
+	ooms map[string]time.Time
+}
+
+func NewExitClassifier() *ExitClassifier {
+	return &ExitClassifier{ooms: map[string]time.Time{}}
+}
+
+// Classify sets m.ExitClass for container die and oom events
+func (c *ExitClassifier) Classify(m *Event) {
+	if m.Type != "container" {
+		return
+	}
+	now := eventTime(*m)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, at := range c.ooms {
+		if now.Sub(at) > oomWindow {
+			delete(c.ooms, id)
+		}
+	}
+	switch m.Status {
+	case "oom":
+		c.ooms[m.ID] = now
+		m.ExitClass = ExitOom
+	case "die":
+		if _, ok := c.ooms[m.ID]; ok {
+			delete(c.ooms, m.ID)
+			m.ExitClass = ExitOom
+			return
+		}
+		m.ExitClass = ExitClass(m.Actor.Attributes.ExitCode)
+	}
+}
+
+// ExitClass maps a Docker exit code to its exit class
+func ExitClass(exitCode string) string {
+	code, err := strconv.Atoi(exitCode)
+	if err != nil {
+		return ExitError
+	}
+	switch code {
+	case 0:
+		return ExitClean
+	case 137:
+		return ExitSigkill
+	case 143:
+		return ExitSigterm
+	}
+	return ExitError
+}
+
+// Failed reports whether a container that exited with exitClass failed, as opposed to being
+// stopped by Swarm during rolling updates and scale-downs with SIGTERM, or SIGKILL after the stop timeout
+func Failed(exitClass string) bool {
+	return exitClass == ExitError || exitClass == ExitOom
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Exit codes", func() {
+	DescribeTable("ExitClass",
+		func(code, class string) {
+			Expect(ExitClass(code)).To(Equal(class))
+		},
+		Entry("clean", "0", ExitClean),
+		Entry("application error", "1", ExitError),
+		Entry("SIGKILL", "137", ExitSigkill),
+		Entry("SIGTERM", "143", ExitSigterm),
+		Entry("missing", "", ExitError),
+	)
+
+	It("classifies the die following an oom of the same container as oom", func() {
+		c := NewExitClassifier()
+		at := time.Unix(1500000000, 0)
+		oom := containerEvent("oom", "a", "s.1.x", "", at)
+		c.Classify(&oom)
+		Expect(oom.ExitClass).To(Equal(ExitOom))
+
+		other := containerEvent("die", "b", "s.2.x", "137", at.Add(time.Second))
+		c.Classify(&other)
+		Expect(other.ExitClass).To(Equal(ExitSigkill))
+
+		die := containerEvent("die", "a", "s.1.x", "137", at.Add(time.Second))
+		c.Classify(&die)
+		Expect(die.ExitClass).To(Equal(ExitOom))
+	})
+
+	It("forgets an oom after the oom window", func() {
+		c := NewExitClassifier()
+		at := time.Unix(1500000000, 0)
+		oom := containerEvent("oom", "a", "s.1.x", "", at)
+		c.Classify(&oom)
+		die := containerEvent("die", "a", "s.1.x", "137", at.Add(2*oomWindow))
+		c.Classify(&die)
+		Expect(die.ExitClass).To(Equal(ExitSigkill))
+	})
+})
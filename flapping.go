@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// FlappingConfig thresholds of the crash-loop detection, a zero Threshold disables it
+type FlappingConfig struct {
+	Threshold int           `yaml:"threshold"` // die/start cycles within Window marking a service as flapping
+	Window    time.Duration `yaml:"window"`
+	Stable    time.Duration `yaml:"stable"` // time without a die after which a flapping service has recovered
+}
+
+// FlapTracker counts die/start cycles per Swarm service within a sliding window
+type FlapTracker struct {
+	cfg      FlappingConfig
+	mu       sync.Mutex
+	services map[string]*serviceFlaps
+}
+
+type serviceFlaps struct {
+	dies     []time.Time
+	starts   []time.Time
+	flapping bool
+	since    time.Time
+	lastDie  time.Time
+	peak     int
+}
+
+func NewFlapTracker(cfg FlappingConfig) *FlapTracker {
+	if cfg.Window == 0 {
+		cfg.Window = 10 * time.Minute
+	}
+	if cfg.Stable == 0 {
+		cfg.Stable = cfg.Window
+	}
+	return &FlapTracker{cfg: cfg, services: map[string]*serviceFlaps{}}
+}
+
+// Observe records a container event, it returns a "flapping" notification once the threshold is passed
+// and reports whether the service is currently flapping
+func (t *FlapTracker) Observe(Cluster string, m Event) (*Notification, bool) {
+	service := m.Actor.Attributes.ComDockerSwarmServiceName
+	if t == nil || service == "" || m.Type != "container" || (m.Status != "die" && m.Status != "start") {
+		return nil, false
+	}
+	now := eventTime(m)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.services[service]
+	if !ok {
+		s = &serviceFlaps{}
+		t.services[service] = s
+	}
+	if m.Status == "die" {
+		s.dies = append(s.dies, now)
+		s.lastDie = now
+	} else {
+		s.starts = append(s.starts, now)
+	}
+	s.dies = within(s.dies, now.Add(-t.cfg.Window))
+	s.starts = within(s.starts, now.Add(-t.cfg.Window))
+	if len(s.dies) > s.peak {
+		s.peak = len(s.dies)
+	}
+
+	if s.flapping || len(s.dies) < t.cfg.Threshold {
+		return nil, s.flapping
+	}
+	s.flapping = true
+	s.since = now
+	s.peak = len(s.dies)
+	log.WithFields(log.Fields{"service": service, "dies": len(s.dies), "starts": len(s.starts), "window": t.cfg.Window}).Warn("Service flapping")
+	return &Notification{
+		Class:    ClassFlapping,
+		Severity: "error",
+		Cluster:  Cluster,
+		Message:  fmt.Sprintf("[%s] %s is flapping: %d die / %d start within %s", Cluster, service, len(s.dies), len(s.starts), t.cfg.Window),
+		Counts:   map[string]int{"die": len(s.dies), "start": len(s.starts)},
+		Event:    m,
+	}, true
+}
+
+// Expire returns a "recovered" notification for every flapping service without a die for Stable
+func (t *FlapTracker) Expire(Cluster string, now time.Time) []*Notification {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var ns []*Notification
+	for service, s := range t.services {
+		quiet := now.Sub(s.lastDie)
+		if s.flapping && quiet >= t.cfg.Stable {
+			log.WithFields(log.Fields{"service": service, "flapping": now.Sub(s.since)}).Info("Service recovered")
+			ns = append(ns, &Notification{
+				Class:    ClassRecovered,
+				Severity: "info",
+				Cluster:  Cluster,
+				Message:  fmt.Sprintf("[%s] %s recovered: stable for %s after flapping with up to %d die within %s", Cluster, service, t.cfg.Stable, s.peak, t.cfg.Window),
+				Counts:   map[string]int{"die": s.peak},
+				Event:    recoveredEvent(service),
+			})
+			s.flapping = false
+		}
+		if !s.flapping && quiet >= t.cfg.Window {
+			delete(t.services, service)
+		}
+	}
+	return ns
+}
+
+func recoveredEvent(service string) Event {
+	var m Event
+	m.Type = "container"
+	m.Actor.Attributes.ComDockerSwarmServiceName = service
+	return m
+}
+
+// within drops all times before since, ts is ordered
+func within(ts []time.Time, since time.Time) []time.Time {
+	i := 0
+	for i < len(ts) && ts[i].Before(since) {
+		i++
+	}
+	return ts[i:]
+}
+
+// eventTime when the Docker daemon emitted m, falling back to now
+func eventTime(m Event) time.Time {
+	if m.TimeNano > 0 {
+		return time.Unix(0, m.TimeNano)
+	}
+	if m.Time > 0 {
+		return time.Unix(int64(m.Time), 0)
+	}
+	return time.Now()
+}
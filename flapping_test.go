@@ -0,0 +1,57 @@
+package main
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FlapTracker", func() {
+	var (
+		t  *FlapTracker
+		at time.Time
+	)
+
+	BeforeEach(func() {
+		t = NewFlapTracker(FlappingConfig{Threshold: 3, Window: time.Minute, Stable: 5 * time.Minute})
+		at = time.Unix(1500000000, 0)
+	})
+
+	die := func(offset time.Duration) (*Notification, bool) {
+		return t.Observe("prod", containerEvent("die", "a", "s.1.x", "1", at.Add(offset)))
+	}
+
+	It("reports a service once it dies Threshold times within Window", func() {
+		n, flapping := die(0)
+		Expect(n).To(BeNil())
+		Expect(flapping).To(BeFalse())
+		die(10 * time.Second)
+		n, flapping = die(20 * time.Second)
+		Expect(flapping).To(BeTrue())
+		Expect(n.Class).To(Equal(ClassFlapping))
+		Expect(n.Counts).To(HaveKeyWithValue("die", 3))
+
+		n, flapping = die(30 * time.Second)
+		Expect(n).To(BeNil())
+		Expect(flapping).To(BeTrue())
+	})
+
+	It("ignores dies spread wider than Window", func() {
+		die(0)
+		die(50 * time.Second)
+		_, flapping := die(2 * time.Minute)
+		Expect(flapping).To(BeFalse())
+	})
+
+	It("recovers a service without a die for Stable", func() {
+		die(0)
+		die(time.Second)
+		die(2 * time.Second)
+		Expect(t.Expire("prod", at.Add(4*time.Minute))).To(BeEmpty())
+		ns := t.Expire("prod", at.Add(6*time.Minute))
+		Expect(ns).To(HaveLen(1))
+		Expect(ns[0].Class).To(Equal(ClassRecovered))
+		Expect(t.Expire("prod", at.Add(7*time.Minute))).To(BeEmpty())
+	})
+})
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// GroupingConfig batches notifications of the listed classes into digests, alike Alertmanager grouping.
+// A member of a digest keeps firing while its service is broken, see Grouper.Firing.
+type GroupingConfig struct {
+	Classes        []string      `yaml:"classes"`
+	GroupBy        []string      `yaml:"group_by"`        // any of cluster, service, node, status
+	GroupWait      time.Duration `yaml:"group_wait"`      // delay of the first digest of a new group
+	GroupInterval  time.Duration `yaml:"group_interval"`  // minimal delay between digests of a group
+	RepeatInterval time.Duration `yaml:"repeat_interval"` // delay before the members still firing are sent again, default 4h
+}
+
+// groupLabels extract the value of a group-by key from a notification
+var groupLabels = map[string]func(n *Notification) string{
+	"cluster": func(n *Notification) string { return n.Cluster },
+	"service": func(n *Notification) string { return n.Event.Actor.Attributes.ComDockerSwarmServiceName },
+	"node":    func(n *Notification) string { return n.Event.NodeID() },
+	"status":  func(n *Notification) string { return n.Event.Status },
+}
+
+// Grouper collects notifications per group and flushes them as digests
+type Grouper struct {
+	cfg     GroupingConfig
+	classes map[string]bool
+	mu      sync.Mutex
+	groups  map[string]*alertGroup
+
+	// Firing reports whether the condition of a sent notification persists, nil repeats nothing
+	Firing func(n *Notification) bool
+}
+
+type alertGroup struct {
+	key       string
+	labels    []string
+	pending   []*Notification
+	firing    map[string]*Notification // sent members by message, while their condition persists
+	created   time.Time
+	lastFlush time.Time
+	lastSeen  time.Time
+}
+
+func NewGrouper(cfg GroupingConfig) (*Grouper, error) {
+	for _, key := range cfg.GroupBy {
+		if _, ok := groupLabels[key]; !ok {
+			return nil, fmt.Errorf("grouping: unknown group_by key %q", key)
+		}
+	}
+	if cfg.GroupWait == 0 {
+		cfg.GroupWait = 30 * time.Second
+	}
+	if cfg.GroupInterval == 0 {
+		cfg.GroupInterval = 5 * time.Minute
+	}
+	if cfg.RepeatInterval == 0 {
+		cfg.RepeatInterval = 4 * time.Hour
+	}
+	g := &Grouper{cfg: cfg, classes: map[string]bool{}, groups: map[string]*alertGroup{}}
+	for _, class := range cfg.Classes {
+		g.classes[class] = true
+	}
+	return g, nil
+}
+
+// Add takes over n at now if its class is grouped, otherwise false is returned and n must be sent directly
+func (g *Grouper) Add(n *Notification, now time.Time) bool {
+	if g == nil || !g.classes[n.Class] {
+		return false
+	}
+	labels := []string{"class=" + n.Class}
+	for _, key := range g.cfg.GroupBy {
+		labels = append(labels, key+"="+groupLabels[key](n))
+	}
+	key := strings.Join(labels, ",")
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	group, ok := g.groups[key]
+	if !ok {
+		group = &alertGroup{key: key, labels: labels, firing: map[string]*Notification{}, created: now}
+		g.groups[key] = group
+	}
+	group.lastSeen = now
+	group.pending = append(group.pending, n)
+	return true
+}
+
+// Flush returns the digests of all groups due at now, and repeats those of groups
+// whose members are still firing RepeatInterval after their last digest
+func (g *Grouper) Flush(now time.Time) []*Notification {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var digests []*Notification
+	for key, group := range g.groups {
+		for msg, n := range group.firing {
+			if g.Firing == nil || !g.Firing(n) {
+				delete(group.firing, msg)
+			}
+		}
+		due := group.lastFlush.Add(g.cfg.GroupInterval)
+		if group.lastFlush.IsZero() {
+			due = group.created.Add(g.cfg.GroupWait)
+		}
+		switch {
+		case len(group.pending) > 0 && !now.Before(due):
+			digests = append(digests, g.digest(group, now))
+		case len(group.pending) == 0 && len(group.firing) > 0 && now.Sub(group.lastFlush) >= g.cfg.RepeatInterval:
+			for _, n := range group.firing {
+				group.pending = append(group.pending, n)
+			}
+			sort.Slice(group.pending, func(i, j int) bool { return group.pending[i].Message < group.pending[j].Message })
+			log.WithFields(log.Fields{"group": key, "members": len(group.pending)}).Info("Digest repeated, members still firing")
+			digests = append(digests, g.digest(group, now))
+		case len(group.pending) == 0 && len(group.firing) == 0 && now.Sub(group.lastSeen) >= g.cfg.GroupInterval:
+			delete(g.groups, key)
+		}
+	}
+	return digests
+}
+
+// FlushAll returns the digests of all groups with pending notifications at now, due or not
+func (g *Grouper) FlushAll(now time.Time) []*Notification {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var digests []*Notification
+	for _, group := range g.groups {
+		if len(group.pending) > 0 {
+			digests = append(digests, g.digest(group, now))
+		}
+	}
+	return digests
+}
+
+// Requeue puts the members of digest d, which could not be dispatched at now,
+// back in front of the pending notifications of its group
+func (g *Grouper) Requeue(d *Notification, now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	group, ok := g.groups[d.Group]
+	if !ok {
+		group = &alertGroup{key: d.Group, labels: strings.Split(d.Group, ","), firing: map[string]*Notification{}, created: now}
+		g.groups[d.Group] = group
+	}
+	group.pending = append(d.Members, group.pending...)
+	group.lastSeen = now
+}
+
+// digest of the pending notifications of group, remembered as firing if Firing says so
+func (g *Grouper) digest(group *alertGroup, now time.Time) *Notification {
+	members := group.pending
+	group.pending = nil
+	group.lastFlush = now
+	for _, n := range members {
+		if g.Firing != nil && g.Firing(n) {
+			group.firing[n.Message] = n
+		}
+	}
+
+	first := members[0]
+	d := &Notification{Class: first.Class, Rule: first.Rule, Severity: first.Severity, Cluster: first.Cluster, Endpoint: first.Endpoint, Event: first.Event, Group: group.key}
+	lines := make([]string, 0, len(members))
+	for _, n := range members {
+		if severityRank(n.Severity) > severityRank(d.Severity) {
+			d.Severity = n.Severity
+		}
+		lines = append(lines, n.Message)
+		d.Members = append(d.Members, n)
+	}
+	if len(members) == 1 {
+		d.Message = first.Message
+	} else {
+		sort.Strings(lines)
+		d.Message = fmt.Sprintf("%d alerts (%s):\n%s", len(members), strings.Join(group.labels[1:], ", "), strings.Join(lines, "\n"))
+	}
+	log.WithFields(log.Fields{"group": group.key, "members": len(members)}).Info("Digest")
+	return d
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Grouper", func() {
+	var g *Grouper
+	now := time.Unix(1500000000, 0)
+
+	BeforeEach(func() {
+		var err error
+		g, err = NewGrouper(GroupingConfig{Classes: []string{ClassEvent}, GroupBy: []string{"service"}, GroupWait: time.Minute, GroupInterval: 5 * time.Minute})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	notification := func(task, msg string) *Notification {
+		return &Notification{Class: ClassEvent, Severity: "warning", Message: msg, Event: containerEvent("die", "a", task, "1", now)}
+	}
+
+	It("rejects unknown group_by keys", func() {
+		_, err := NewGrouper(GroupingConfig{GroupBy: []string{"image"}})
+		Expect(err).To(MatchError(ContainSubstring(`"image"`)))
+	})
+
+	It("leaves classes not grouped to be sent directly", func() {
+		Expect(g.Add(&Notification{Class: ClassOom}, now)).To(BeFalse())
+	})
+
+	It("flushes a digest per group after GroupWait", func() {
+		Expect(g.Add(notification("a.1.x", "a died"), now)).To(BeTrue())
+		Expect(g.Add(notification("a.2.x", "a died again"), now)).To(BeTrue())
+		Expect(g.Add(notification("b.1.x", "b died"), now)).To(BeTrue())
+		Expect(g.Flush(now)).To(BeEmpty())
+
+		digests := g.Flush(now.Add(time.Minute))
+		Expect(digests).To(HaveLen(2))
+		for _, d := range digests {
+			if d.Group == "class=event,service=a" {
+				Expect(d.Members).To(HaveLen(2))
+				Expect(d.Message).To(HavePrefix("2 alerts (service=a)"))
+			} else {
+				Expect(d.Group).To(Equal("class=event,service=b"))
+				Expect(d.Message).To(Equal("b died"))
+			}
+		}
+	})
+
+	It("waits GroupInterval between digests of a group", func() {
+		g.Add(notification("a.1.x", "first"), now)
+		Expect(g.Flush(now.Add(time.Minute))).To(HaveLen(1))
+		g.Add(notification("a.1.y", "second"), now)
+		Expect(g.Flush(now.Add(2 * time.Minute))).To(BeEmpty())
+		Expect(g.Flush(now.Add(7 * time.Minute))).To(HaveLen(1))
+	})
+
+	It("repeats the members still firing after RepeatInterval", func() {
+		broken := map[string]bool{"a died": true, "a died again": true}
+		g.Firing = func(n *Notification) bool { return broken[n.Message] }
+		g.cfg.RepeatInterval = time.Hour
+		g.Add(notification("a.1.x", "a died"), now)
+		g.Add(notification("a.2.x", "a died again"), now)
+		g.Add(notification("a.3.x", "a stopped"), now)
+		digests := g.Flush(now.Add(2 * time.Minute))
+		Expect(digests).To(HaveLen(1))
+		Expect(digests[0].Members).To(HaveLen(3))
+		Expect(g.Flush(now.Add(30 * time.Minute))).To(BeEmpty())
+
+		broken["a died again"] = false
+		digests = g.Flush(now.Add(62 * time.Minute))
+		Expect(digests).To(HaveLen(1))
+		Expect(digests[0].Message).To(Equal("a died"))
+
+		broken["a died"] = false
+		Expect(g.Flush(now.Add(3 * time.Hour))).To(BeEmpty())
+		Expect(g.groups).To(BeEmpty())
+	})
+
+	It("repeats nothing without Firing", func() {
+		g.Add(notification("a.1.x", "a died"), now)
+		Expect(g.Flush(now.Add(time.Minute))).To(HaveLen(1))
+		Expect(g.Flush(now.Add(5 * time.Hour))).To(BeEmpty())
+	})
+
+	It("keeps the members of a digest that could not be dispatched", func() {
+		g.Add(notification("a.1.x", "first"), now)
+		d := g.FlushAll(now)[0]
+		g.Requeue(d, now)
+		g.Add(notification("a.1.y", "second"), now)
+		digests := g.FlushAll(now)
+		Expect(digests).To(HaveLen(1))
+		Expect(fmt.Sprint(digests[0].Message)).To(ContainSubstring("first\nsecond"))
+	})
+})
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// IncidentConfig when an incident of a service counts as resolved
+type IncidentConfig struct {
+	Stable time.Duration `yaml:"stable"` // time all tasks have to be running without failure, default 5m
+}
+
+// Incident failures of one service from the first die or oom until its tasks are running and stable again
+type Incident struct {
+	ID        string     `json:"id"`
+	Cluster   string     `json:"cluster"`
+	Service   string     `json:"service"`
+	Started   time.Time  `json:"started"`
+	Updated   time.Time  `json:"updated"`
+	Ended     *time.Time `json:"ended,omitempty"`
+	Count     int        `json:"count"`
+	ExitCode  string     `json:"exit_code,omitempty"`
+	ExitClass string     `json:"exit_class,omitempty"`
+
+	lastOom string // container of the last oom, its die is the same failure
+}
+
+// IncidentTracker keeps the open incident per service
+type IncidentTracker struct {
+	cfg      IncidentConfig
+	mu       sync.Mutex
+	services map[string]*Incident
+}
+
+func NewIncidentTracker(cfg IncidentConfig) *IncidentTracker {
+	if cfg.Stable == 0 {
+		cfg.Stable = 5 * time.Minute
+	}
+	return &IncidentTracker{cfg: cfg, services: map[string]*Incident{}}
+}
+
+// Observe opens an incident on a failed die or an oom of a service, or updates the open one.
+// Dies by sigterm or sigkill are stops, e.g. of a rolling update or scale-down, and open none.
+func (t *IncidentTracker) Observe(Cluster string, m Event) *Notification {
+	service := m.Actor.Attributes.ComDockerSwarmServiceName
+	if service == "" || m.Type != "container" {
+		return nil
+	}
+	switch {
+	case m.Status == "oom":
+	case m.Status == "die" && Failed(m.ExitClass):
+	default:
+		return nil
+	}
+	now := eventTime(m)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	inc, ok := t.services[service]
+	if ok && m.Status == "die" && m.ExitClass == ExitOom && inc.lastOom == m.ID {
+		inc.ExitCode = m.Actor.Attributes.ExitCode
+		inc.lastOom = ""
+		return nil
+	}
+	class := ClassIncidentUpdated
+	if !ok {
+		class = ClassIncidentOpened
+		inc = &Incident{
+			ID:      fmt.Sprintf("%s-%s-%d", Cluster, service, now.Unix()),
+			Cluster: Cluster,
+			Service: service,
+			Started: now,
+		}
+		t.services[service] = inc
+	}
+	inc.Count++
+	inc.Updated = now
+	inc.ExitCode = m.Actor.Attributes.ExitCode
+	inc.ExitClass = m.ExitClass
+	if m.Status == "oom" {
+		inc.ExitClass = ExitOom
+		inc.lastOom = m.ID
+	}
+
+	severity, verb := "error", "opened"
+	if inc.ExitClass == ExitOom {
+		severity = "critical"
+	}
+	if class == ClassIncidentUpdated {
+		verb = fmt.Sprintf("failure #%d", inc.Count)
+	}
+	log.WithFields(log.Fields{"incident": inc.ID, "service": service, "count": inc.Count}).Warn("Incident " + class)
+	c := *inc
+	return &Notification{
+		Class:    class,
+		Severity: severity,
+		Cluster:  Cluster,
+		Message:  fmt.Sprintf("[%s] incident %s %s: %s %s (%s)", Cluster, inc.ID, verb, service, m.Status, inc.ExitClass),
+		Counts:   map[string]int{"failures": inc.Count},
+		Event:    m,
+		Incident: &c,
+	}
+}
+
+// Resolve returns a "incident.resolved" notification for every incident whose service
+// has been running without failure for Stable according to state
+func (t *IncidentTracker) Resolve(Cluster string, now time.Time, state *SwarmState) []*Notification {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var ns []*Notification
+	for service, inc := range t.services {
+		since, running := state.RunningSince(service)
+		if !running || now.Sub(since) < t.cfg.Stable || now.Sub(inc.Updated) < t.cfg.Stable {
+			continue
+		}
+		inc.Ended = &now
+		delete(t.services, service)
+		log.WithFields(log.Fields{"incident": inc.ID, "service": service, "count": inc.Count, "duration": now.Sub(inc.Started)}).Info("Incident resolved")
+		ns = append(ns, &Notification{
+			Class:    ClassIncidentResolved,
+			Severity: "info",
+			Cluster:  Cluster,
+			Message:  fmt.Sprintf("[%s] incident %s resolved: %s running and stable for %s after %d failure(s) within %s", Cluster, inc.ID, service, t.cfg.Stable, inc.Count, inc.Updated.Sub(inc.Started)),
+			Counts:   map[string]int{"failures": inc.Count},
+			Event:    recoveredEvent(service),
+			Incident: inc,
+		})
+	}
+	return ns
+}
+
+// Open copies of the open incidents sorted by start
+func (t *IncidentTracker) Open() []Incident {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	incidents := []Incident{}
+	for _, inc := range t.services {
+		incidents = append(incidents, *inc)
+	}
+	sort.Slice(incidents, func(i, j int) bool { return incidents[i].Started.Before(incidents[j].Started) })
+	return incidents
+}
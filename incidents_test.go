@@ -0,0 +1,65 @@
+package main
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("IncidentTracker", func() {
+	var (
+		t  *IncidentTracker
+		at time.Time
+	)
+
+	BeforeEach(func() {
+		t = NewIncidentTracker(IncidentConfig{Stable: time.Minute})
+		at = time.Unix(1500000000, 0)
+	})
+
+	die := func(id, exitCode, exitClass string, at time.Time) Event {
+		m := containerEvent("die", id, "db.1.x", exitCode, at)
+		m.ExitClass = exitClass
+		return m
+	}
+
+	DescribeTable("opens incidents only for failed exits",
+		func(exitCode, exitClass string, opens bool) {
+			n := t.Observe("prod", die("a", exitCode, exitClass, at))
+			if !opens {
+				Expect(n).To(BeNil())
+				Expect(t.Open()).To(BeEmpty())
+				return
+			}
+			Expect(n.Class).To(Equal(ClassIncidentOpened))
+			Expect(t.Open()).To(HaveLen(1))
+		},
+		Entry("error", "1", ExitError, true),
+		Entry("oom", "137", ExitOom, true),
+		Entry("clean", "0", ExitClean, false),
+		Entry("sigterm", "143", ExitSigterm, false),
+		Entry("sigkill", "137", ExitSigkill, false),
+	)
+
+	It("counts an oom and the die of its container as one failure", func() {
+		Expect(t.Observe("prod", containerEvent("oom", "a", "db.1.x", "", at)).Class).To(Equal(ClassIncidentOpened))
+		Expect(t.Observe("prod", die("a", "137", ExitOom, at))).To(BeNil())
+		n := t.Observe("prod", die("b", "1", ExitError, at.Add(time.Second)))
+		Expect(n.Class).To(Equal(ClassIncidentUpdated))
+		Expect(n.Incident.Count).To(Equal(2))
+	})
+
+	It("resolves once the service has been running stable", func() {
+		t.Observe("prod", die("a", "1", ExitError, at))
+		state := NewSwarmState("prod")
+		state.Observe(containerEvent("start", "b", "db.1.x", "", at.Add(time.Second)))
+
+		Expect(t.Resolve("prod", at.Add(30*time.Second), state)).To(BeEmpty())
+		ns := t.Resolve("prod", at.Add(2*time.Minute), state)
+		Expect(ns).To(HaveLen(1))
+		Expect(ns[0].Class).To(Equal(ClassIncidentResolved))
+		Expect(t.Open()).To(BeEmpty())
+	})
+})
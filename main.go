@@ -4,16 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
-	"regexp"
 	_ "strconv"
 	"strings"
+	"time"
 
-	"github.com/Shopify/sarama"
 	log "github.com/Sirupsen/logrus"
-	"github.com/larskluge/babl-server/kafka"
 	. "github.com/larskluge/babl-server/utils"
-	bn "github.com/larskluge/babl/bablnaming"
 )
 
 //Warning log level
@@ -22,10 +18,7 @@ import (
 const (
 	Version     = "0.0.2"
 	TopicEvents = "logs.events"
-)
-
-var (
-	EventsRegex = regexp.MustCompile("die$|start$|oom$")
+	TopicAlerts = "logs.alerts"
 )
 
 type Event struct {
@@ -35,90 +28,173 @@ type Event struct {
 	Type   string `json:"Type"`
 	Action string `json:"Action"`
 	Actor  struct {
-		ID         string `json:"ID"`
-		Attributes struct {
-			ComDockerSwarmNodeID      string `json:"com.docker.swarm.node.id"`
-			ComDockerSwarmServiceID   string `json:"com.docker.swarm.service.id"`
-			ComDockerSwarmServiceName string `json:"com.docker.swarm.service.name"`
-			ComDockerSwarmTask        string `json:"com.docker.swarm.task"`
-			ComDockerSwarmTaskID      string `json:"com.docker.swarm.task.id"`
-			ComDockerSwarmTaskName    string `json:"com.docker.swarm.task.name"`
-			Image                     string `json:"image"`
-			Name                      string `json:"name"`
-		} `json:"Attributes"`
+		ID         string          `json:"ID"`
+		Attributes EventAttributes `json:"Attributes"`
 	} `json:"Actor"`
 	Time     int   `json:"time"`
 	TimeNano int64 `json:"timeNano"`
-}
 
-func main() {
-	log.SetOutput(os.Stderr)
-	log.SetFormatter(&log.JSONFormatter{})
+	// ExitClass derived by sentinel for die and oom events, see ExitClassifier
+	ExitClass string `json:"exitClass,omitempty"`
+	// Uptime derived by sentinel for die and oom events, how long the container had been running
+	Uptime time.Duration `json:"uptime,omitempty"`
+	// Origin set by sentinel's event source, e.g. the Kafka offset
+	Origin *EventOrigin `json:"origin,omitempty"`
+}
 
-	app := configureCli()
-	app.Run(os.Args)
+// NodeID of the swarm node the event is about, or happened on
+func (m *Event) NodeID() string {
+	if m.Type == "node" {
+		return m.Actor.ID
+	}
+	return m.Actor.Attributes.ComDockerSwarmNodeID
 }
 
-func run(kafkaBrokers string, dbg bool) {
+// EventAttributes well known actor attributes, Raw holds all of them including unknown ones
+type EventAttributes struct {
+	ComDockerSwarmNodeID      string            `json:"com.docker.swarm.node.id"`
+	ComDockerSwarmServiceID   string            `json:"com.docker.swarm.service.id"`
+	ComDockerSwarmServiceName string            `json:"com.docker.swarm.service.name"`
+	ComDockerSwarmTask        string            `json:"com.docker.swarm.task"`
+	ComDockerSwarmTaskID      string            `json:"com.docker.swarm.task.id"`
+	ComDockerSwarmTaskName    string            `json:"com.docker.swarm.task.name"`
+	ExitCode                  string            `json:"exitCode,omitempty"`
+	Image                     string            `json:"image"`
+	Name                      string            `json:"name"`
+	Raw                       map[string]string `json:"-"`
+}
 
-	if dbg {
-		log.SetLevel(log.DebugLevel)
+// MarshalJSON emits all raw attributes, overlaid by the well known ones which are set
+func (a EventAttributes) MarshalJSON() ([]byte, error) {
+	all := map[string]string{}
+	for k, v := range a.Raw {
+		all[k] = v
+	}
+	type attributes EventAttributes
+	known, err := json.Marshal(attributes(a))
+	if err != nil {
+		return nil, err
 	}
-	brokers := strings.Split(kafkaBrokers, ",")
-	Cluster := SplitFirst(kafkaBrokers, ".")
-	ParseEvents(Cluster, brokers)
+	var fields map[string]string
+	if err := json.Unmarshal(known, &fields); err != nil {
+		return nil, err
+	}
+	for k, v := range fields {
+		if v != "" || all[k] == "" {
+			all[k] = v
+		}
+	}
+	return json.Marshal(all)
+}
 
+func (a *EventAttributes) UnmarshalJSON(data []byte) error {
+	type attributes EventAttributes
+	if err := json.Unmarshal(data, (*attributes)(a)); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &a.Raw)
 }
 
-func ParseEvents(Cluster string, brokers []string) {
+func main() {
+	log.SetOutput(os.Stderr)
+	log.SetFormatter(&log.JSONFormatter{})
 
-	client := *kafka.NewClient(brokers, "sentinel", true)
-	defer client.Close()
+	app := configureCli()
+	app.Run(os.Args)
+}
 
-	consumer, err := sarama.NewConsumerFromClient(client)
-	Check(err)
-	defer consumer.Close()
+// Options of a sentinel run, as given on the command line
+type Options struct {
+	KafkaBrokers string
+	Cluster      string
+	Group        string
+	Source       string
+	DockerHost   string
+	ConfigPath   string
+	RulesPath    string
+	HTTPAddr     string
+	AlertsTopic  string
+	DryRun       bool
+	DryRunKeep   int
+	Debug        bool
+
+	// replay
+	ReplayFile  string
+	ReplaySpeed string
+}
 
-	offsetNewest, err := client.GetOffset(TopicEvents, 0, sarama.OffsetNewest)
-	Check(err)
+func run(o Options) {
 
-	cp, err := consumer.ConsumePartition(TopicEvents, 0, offsetNewest)
-	Check(err)
-	defer cp.Close()
-	for msg := range cp.Messages() {
-		var m Event
-		err := json.Unmarshal(msg.Value, &m)
-		Check(err)
-		log.WithFields(log.Fields{"broker": brokers, "event": m}).Debug("Docker Event")
-		if m.Type == "container" && EventsRegex.MatchString(m.Status) {
-			notify(Cluster, m)
-		}
-		if m.Type == "container" && m.Status == "oom" {
-			notifyOom(Cluster, m)
+	if o.Debug {
+		log.SetLevel(log.DebugLevel)
+	}
+	cfg := LoadConfig(o.ConfigPath)
+	clusters := cfg.Clusters
+	if len(clusters) == 0 || o.Source != "kafka" {
+		clusters = []ClusterConfig{{Name: ClusterName(o.Cluster, o.KafkaBrokers), Brokers: strings.Split(o.KafkaBrokers, ",")}}
+	}
+	for i := range clusters {
+		clusters[i] = clusters[i].withDefaults(o.Group)
+		if o.DryRun {
+			// never take partitions from, or commit offsets for, the live consumer group
+			clusters[i].Group += "-dry-run"
 		}
 	}
-}
-
-func notify(Cluster string, m Event) {
-	log.WithFields(log.Fields{"cluster": Cluster, "instance": m.Actor.Attributes.ComDockerSwarmTaskName, "status": m.Status, "id": m.ID, "from": m.From}).Info("Docker Event")
-	name := m.Actor.Attributes.ComDockerSwarmTaskName
-	if name == "" {
-		name = m.From
-	}
-	str := fmt.Sprintf("[%s] %s --> %s", Cluster, name, m.Status)
-	args := []string{"-c", "sandbox.babl.sh:4445", "babl/events", "-e", "EVENT=babl:error"}
-	cmd := exec.Command("/bin/babl", args...)
-	cmd.Stdin = strings.NewReader(str)
-	err := cmd.Run()
+	if o.AlertsTopic != "" {
+		cfg.PublishAlerts(o.AlertsTopic)
+	}
+	cfg.DefaultBrokers(clusters[0].Brokers)
+	if o.DryRun {
+		// leave the live instance's outbox and dead-letter topic alone, dead letters are only logged
+		cfg.Retry.Dir = ""
+		cfg.DeadLetter = DeadLetterConfig{}
+	}
+	dispatcher, err := NewDispatcher(cfg)
 	Check(err)
-}
+	if o.DryRun {
+		log.WithFields(log.Fields{"keep": o.DryRunKeep}).Warn("Dry run, notifications are recorded instead of sent")
+		dispatcher.Recorder = NewRecorder(o.DryRunKeep)
+	}
+	dispatcher.Start()
+	rules := LoadRules(o.RulesPath)
+	var pipelines []*Pipeline
+	for _, c := range clusters {
+		pipeline := NewPipeline(c, cfg, rules, dispatcher)
+		pipeline.Start()
+		pipelines = append(pipelines, pipeline)
+	}
+	if o.HTTPAddr != "" {
+		go serveHTTP(o.HTTPAddr, pipelines)
+	}
 
-//babl -c 192.168.99.100:4445 babl/oom-restart -e MODULE=larskluge/image-resize -e INSTANCE_ID=7b43d4142a24
-func notifyOom(Cluster string, m Event) {
-	module := bn.ServiceToModule(m.Actor.Attributes.ComDockerSwarmServiceName)
-	args := []string{"-c", Cluster + ".babl.sh:4445", "babl/events", "-e", "EVENT=babl:module:oom", "-e", "MODULE=" + module, "-e", "INSTANCE_ID=" + m.ID}
-	log.WithFields(log.Fields{"args": args}).Info("oom-restart")
-	cmd := exec.Command("/bin/babl", args...)
-	err := cmd.Run()
-	Check(err)
+	var sources []EventSource
+	switch o.Source {
+	case "kafka":
+		for _, c := range clusters {
+			sources = append(sources, &KafkaSource{Cluster: c.Name, Brokers: c.Brokers, Topic: c.Topic, Group: c.Group, DeadLetters: NewDeadLetters(cfg.DeadLetter, c.Brokers)})
+		}
+	case "docker":
+		source, err := NewDockerSource(o.DockerHost)
+		Check(err)
+		sources = append(sources, source)
+	case "replay":
+		speed, err := ParseSpeed(o.ReplaySpeed)
+		Check(err)
+		sources = append(sources, &ReplaySource{File: o.ReplayFile, Speed: speed})
+	default:
+		Check(fmt.Errorf("unknown event source %q", o.Source))
+	}
+	errs := make(chan error, len(sources))
+	for i, source := range sources {
+		go func(source EventSource, pipeline *Pipeline) {
+			errs <- source.Run(instrumented(pipeline))
+		}(source, pipelines[i])
+	}
+	for range sources {
+		Check(<-errs)
+	}
+	for _, pipeline := range pipelines {
+		pipeline.Drain()
+	}
+	dispatcher.Flush()
 }
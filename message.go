@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+	"time"
+
+	bn "github.com/larskluge/babl/bablnaming"
+)
+
+// MessageData is what message templates of rules and notifiers are executed on:
+// the notification with its full Event plus fields derived from the event,
+// e.g. "{{.Cluster}}: {{.Module}} on {{.Node}} exited {{.ExitCode}} ({{.ExitClass}}) after {{duration .Uptime}}"
+type MessageData struct {
+	*Notification
+	Service   string
+	Module    string
+	Task      string
+	Node      string
+	Image     string
+	ExitCode  string
+	ExitClass string
+	Uptime    time.Duration
+}
+
+// messageFuncs helpers available to message templates
+var messageFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"title": strings.Title,
+	"join": func(sep string, s []string) string {
+		return strings.Join(s, sep)
+	},
+	"default": func(fallback, s string) string {
+		if s == "" {
+			return fallback
+		}
+		return s
+	},
+	"truncate": func(n int, s string) string {
+		if n < 0 || len(s) <= n {
+			return s
+		}
+		return s[:n] + "…"
+	},
+	"duration": func(d time.Duration) string {
+		return d.Round(time.Second).String()
+	},
+	"time": func(layout string, nanos int64) string {
+		return time.Unix(0, nanos).UTC().Format(layout)
+	},
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// ParseMessageTemplate parses text and executes it once on a sample notification,
+// so unknown fields and functions are rejected when the config loads
+func ParseMessageTemplate(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Funcs(messageFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.Execute(ioutil.Discard, NewMessageData(SampleNotification())); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// SampleNotification has all optional parts set, like the incident and event origin, so templates
+// referring to them validate; fields only some notifications carry should still be guarded by {{with}}
+func SampleNotification() *Notification {
+	ended := time.Time{}
+	sample := func() *Notification {
+		n := &Notification{Counts: map[string]int{}, Incident: &Incident{Ended: &ended}}
+		n.Event.Origin = &EventOrigin{}
+		return n
+	}
+	n := sample()
+	n.Members = []*Notification{sample()}
+	return n
+}
+
+func NewMessageData(n *Notification) MessageData {
+	m := n.Event
+	a := m.Actor.Attributes
+	image := a.Image
+	if image == "" {
+		image = m.From
+	}
+	return MessageData{
+		Notification: n,
+		Service:      a.ComDockerSwarmServiceName,
+		Module:       bn.ServiceToModule(a.ComDockerSwarmServiceName),
+		Task:         a.ComDockerSwarmTaskName,
+		Node:         m.NodeID(),
+		Image:        image,
+		ExitCode:     a.ExitCode,
+		ExitClass:    m.ExitClass,
+		Uptime:       m.Uptime,
+	}
+}
+
+// RenderMessage executes t on n, yielding the message text
+func RenderMessage(t *template.Template, n *Notification) (string, error) {
+	var b bytes.Buffer
+	if err := t.Execute(&b, NewMessageData(n)); err != nil {
+		return "", fmt.Errorf("template %s: %s", t.Name(), err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
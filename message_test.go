@@ -0,0 +1,39 @@
+package main
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParseMessageTemplate", func() {
+	DescribeTable("accepts templates on optional parts of the notification",
+		func(text string) {
+			_, err := ParseMessageTemplate("t", text)
+			Expect(err).NotTo(HaveOccurred())
+		},
+		Entry("incident", "{{.Incident.ID}} x{{.Incident.Count}}"),
+		Entry("incident end", "{{.Incident.Ended}}"),
+		Entry("event origin", "{{.Event.Origin.Topic}}@{{.Event.Origin.Offset}}"),
+		Entry("group members", "{{range .Members}}{{.Incident.ID}} {{end}}"),
+	)
+
+	DescribeTable("rejects unknown fields and functions",
+		func(text string) {
+			_, err := ParseMessageTemplate("t", text)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("field", "{{.Nope}}"),
+		Entry("nested field", "{{.Incident.Nope}}"),
+		Entry("function", "{{nope .Class}}"),
+	)
+
+	It("renders the incident of a notification", func() {
+		t, err := ParseMessageTemplate("t", "{{.Service}}: {{.Incident.ID}}")
+		Expect(err).NotTo(HaveOccurred())
+		n := &Notification{Incident: &Incident{ID: "inc-1"}, Event: containerEvent("die", "a", "db.1.x", "1", time.Unix(0, 0))}
+		Expect(RenderMessage(t, n)).To(Equal("db: inc-1"))
+	})
+})
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Labels of a single metric series
+type Labels map[string]string
+
+// Metrics minimal registry of labelled counters, gauges and histograms, rendered in Prometheus text format
+type Metrics struct {
+	mu         sync.Mutex
+	counters   map[string]map[string]float64
+	gauges     map[string]map[string]float64
+	histograms map[string]map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // per bucket of histogramBuckets, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// histogramBuckets upper bounds in seconds, shared by all histograms
+var histogramBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metricHelp documents every metric sentinel exposes
+var metricHelp = map[string]string{
+	"sentinel_events_consumed_total":         "Docker events consumed, by type and status.",
+	"sentinel_dead_letters_total":            "Messages parked as dead letter, by reason.",
+	"sentinel_notifications_sent_total":      "Notifications delivered, by notifier.",
+	"sentinel_notifications_failed_total":    "Notification deliveries failed, by notifier.",
+	"sentinel_handler_duration_seconds":      "Time spent handling a single event.",
+	"sentinel_consumer_lag":                  "Docker events not yet handled, by cluster and partition.",
+	"sentinel_last_event_timestamp_seconds":  "Unix time of the last event handled.",
+	"sentinel_retry_queue_deliveries":        "Deliveries waiting in the retry outbox.",
+	"sentinel_notifications_abandoned_total": "Deliveries given up after running out of attempts, by notifier.",
+}
+
+// metrics registry shared by all parts of sentinel
+var metrics = NewMetrics()
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		counters:   map[string]map[string]float64{},
+		gauges:     map[string]map[string]float64{},
+		histograms: map[string]map[string]*histogram{},
+	}
+}
+
+// Inc increments the counter name of the series labels by one
+func (r *Metrics) Inc(name string, labels Labels) {
+	r.Add(name, labels, 1)
+}
+
+// Add increments the counter name of the series labels by v
+func (r *Metrics) Add(name string, labels Labels, v float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	series(r.counters, name)[labels.String()] += v
+}
+
+// Set sets the gauge name of the series labels to v
+func (r *Metrics) Set(name string, labels Labels, v float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	series(r.gauges, name)[labels.String()] = v
+}
+
+// Observe records v in the histogram name of the series labels
+func (r *Metrics) Observe(name string, labels Labels, v float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	hs, ok := r.histograms[name]
+	if !ok {
+		hs = map[string]*histogram{}
+		r.histograms[name] = hs
+	}
+	h, ok := hs[labels.String()]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(histogramBuckets))}
+		hs[labels.String()] = h
+	}
+	for i, le := range histogramBuckets {
+		if v <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// WriteTo renders all metrics in the Prometheus text exposition format
+func (r *Metrics) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var b strings.Builder
+	writeSeries(&b, "counter", r.counters)
+	writeSeries(&b, "gauge", r.gauges)
+	names := make([]string, 0, len(r.histograms))
+	for name := range r.histograms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		writeHeader(&b, name, "histogram")
+		hs := r.histograms[name]
+		keys := make([]string, 0, len(hs))
+		for k := range hs {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, labels := range keys {
+			h := hs[labels]
+			var cumulative uint64
+			for i, le := range histogramBuckets {
+				cumulative += h.counts[i]
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", name, withLabel(labels, "le", fmt.Sprint(le)), cumulative)
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", name, withLabel(labels, "le", "+Inf"), h.count)
+			fmt.Fprintf(&b, "%s_sum%s %g\n", name, labels, h.sum)
+			fmt.Fprintf(&b, "%s_count%s %d\n", name, labels, h.count)
+		}
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func writeSeries(b *strings.Builder, kind string, all map[string]map[string]float64) {
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		writeHeader(b, name, kind)
+		s := all[name]
+		keys := make([]string, 0, len(s))
+		for k := range s {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, labels := range keys {
+			fmt.Fprintf(b, "%s%s %g\n", name, labels, s[labels])
+		}
+	}
+}
+
+func writeHeader(b *strings.Builder, name, kind string) {
+	if help, ok := metricHelp[name]; ok {
+		fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	}
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, kind)
+}
+
+func series(all map[string]map[string]float64, name string) map[string]float64 {
+	s, ok := all[name]
+	if !ok {
+		s = map[string]float64{}
+		all[name] = s
+	}
+	return s
+}
+
+// withLabel adds key="value" to the rendered labels
+func withLabel(labels, key, value string) string {
+	pair := key + `="` + value + `"`
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return labels[:len(labels)-1] + "," + pair + "}"
+}
+
+// String renders labels in Prometheus notation, e.g. {reason="decode"}
+func (l Labels) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(l))
+	for k, v := range l {
+		v = strings.Replace(v, `\`, `\\`, -1)
+		v = strings.Replace(v, `"`, `\"`, -1)
+		v = strings.Replace(v, "\n", `\n`, -1)
+		pairs = append(pairs, k+`="`+v+`"`)
+	}
+	sort.Strings(pairs)
+	return "{" + strings.Join(pairs, ",") + "}"
+}
@@ -0,0 +1,28 @@
+package main
+
+// NodeEvent the swarm specific attributes of a Docker event of Type node
+type NodeEvent struct {
+	ID              string
+	Name            string
+	State           string
+	StateOld        string
+	Availability    string
+	AvailabilityOld string
+	Role            string
+	RoleOld         string
+}
+
+// DecodeNodeEvent extracts the state, availability and role transitions of a node event
+func DecodeNodeEvent(m Event) NodeEvent {
+	a := m.Actor.Attributes.Raw
+	return NodeEvent{
+		ID:              m.Actor.ID,
+		Name:            a["name"],
+		State:           a["state.new"],
+		StateOld:        a["state.old"],
+		Availability:    a["availability.new"],
+		AvailabilityOld: a["availability.old"],
+		Role:            a["role.new"],
+		RoleOld:         a["role.old"],
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"fmt"
+	"text/template"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Event classes notifications are routed by
+const (
+	ClassEvent     = "event"
+	ClassOom       = "oom"
+	ClassFlapping  = "flapping"
+	ClassRecovered = "recovered"
+	ClassNode      = "node"
+
+	// Incident lifecycle of a service, see IncidentTracker
+	ClassIncidentOpened   = "incident.opened"
+	ClassIncidentUpdated  = "incident.updated"
+	ClassIncidentResolved = "incident.resolved"
+
+	// ClassUndeliverable reports notifications whose deliveries ran out of attempts
+	ClassUndeliverable = "undeliverable"
+)
+
+// Notification a single outbound message, handed to every notifier routed for its class
+type Notification struct {
+	Class    string          `json:"class"`
+	Rule     string          `json:"rule,omitempty"`
+	Severity string          `json:"severity,omitempty"`
+	Cluster  string          `json:"cluster"`
+	Endpoint string          `json:"endpoint,omitempty"` // babl endpoint of the cluster
+	Message  string          `json:"message"`
+	Counts   map[string]int  `json:"counts,omitempty"`
+	Incident *Incident       `json:"incident,omitempty"`
+	Services []string        `json:"services,omitempty"`
+	Event    Event           `json:"event"`
+	Group    string          `json:"group,omitempty"`
+	Members  []*Notification `json:"members,omitempty"`
+}
+
+// Notifier delivers notifications to some backend
+type Notifier interface {
+	Name() string
+	Notify(n *Notification) error
+}
+
+// Dispatcher fans notifications out to the notifiers configured per class
+type Dispatcher struct {
+	notifiers map[string]Notifier
+	routes    map[string][]Notifier
+	templates map[string]*template.Template
+	retry     *RetryQueue
+
+	// Recorder captures all notifications instead of delivering them, see --dry-run
+	Recorder *Recorder
+}
+
+// NewNotifier creates the notifier described by cfg
+func NewNotifier(name string, cfg NotifierConfig) (Notifier, error) {
+	switch cfg.Type {
+	case "babl":
+		return NewBablNotifier(name, cfg)
+	case "kafka", "alerts":
+		return NewKafkaNotifier(name, cfg), nil
+	case "webhook":
+		return NewWebhookNotifier(name, cfg)
+	case "slack":
+		return NewSlackNotifier(name, cfg)
+	case "pagerduty":
+		return NewPagerDutyNotifier(name, cfg)
+	case "smtp":
+		return NewSMTPNotifier(name, cfg)
+	case "syslog":
+		return NewSyslogNotifier(name, cfg)
+	case "plugin":
+		return NewPluginNotifier(name, cfg)
+	case "stdout":
+		return NewStdoutNotifier(name), nil
+	}
+	return nil, fmt.Errorf("notifier %q: unknown type %q", name, cfg.Type)
+}
+
+// NewDispatcher builds all notifiers of cfg and resolves its routes
+func NewDispatcher(cfg *Config) (*Dispatcher, error) {
+	retry, err := NewRetryQueue(cfg.Retry)
+	if err != nil {
+		return nil, err
+	}
+	d := &Dispatcher{notifiers: map[string]Notifier{}, routes: map[string][]Notifier{}, templates: map[string]*template.Template{}, retry: retry}
+	for name, nc := range cfg.Notifiers {
+		n, err := NewNotifier(name, nc)
+		if err != nil {
+			return nil, err
+		}
+		d.notifiers[name] = n
+		if a, ok := n.(Abandoner); ok {
+			notifier := name
+			a.OnAbandon(func(n *Notification, attempts int, err error) {
+				d.undeliverable(notifier, n, attempts, err)
+			})
+		}
+		if nc.Template != "" {
+			t, err := ParseMessageTemplate(name, nc.Template)
+			if err != nil {
+				return nil, fmt.Errorf("notifier %q: %s", name, err)
+			}
+			d.templates[name] = t
+		}
+	}
+	for class, names := range cfg.Routes {
+		for _, name := range names {
+			n, ok := d.notifiers[name]
+			if !ok {
+				return nil, fmt.Errorf("route %q: unknown notifier %q", class, name)
+			}
+			d.routes[class] = append(d.routes[class], n)
+		}
+	}
+	return d, nil
+}
+
+// Routes reports whether any notifier is routed for class
+func (d *Dispatcher) Routes(class string) bool {
+	return len(d.routes[class]) > 0
+}
+
+// PermanentError a delivery refused for good, e.g. with a 4xx response, another attempt would fail the same way
+type PermanentError struct {
+	error
+}
+
+// Dispatch hands n to every notifier routed for its class, and to each target of a TargetNotifier.
+// Failed deliveries are queued for retry, permanent failures are reported as undeliverable right away.
+// An error is only returned if queueing failed.
+func (d *Dispatcher) Dispatch(n *Notification) error {
+	var first error
+	for _, notifier := range d.routes[n.Class] {
+		targets := []string{""}
+		if t, ok := notifier.(TargetNotifier); ok && d.Recorder == nil {
+			targets = t.Targets()
+		}
+		for _, target := range targets {
+			err := d.notify(notifier, target, n)
+			if err == nil {
+				continue
+			}
+			log.WithFields(log.Fields{"notifier": notifier.Name(), "target": target, "class": n.Class, "error": err}).Error("Notification failed")
+			if n.Class == ClassUndeliverable {
+				continue
+			}
+			if _, ok := err.(PermanentError); ok {
+				d.undeliverable(notifier.Name(), n, 1, err)
+				continue
+			}
+			if err := d.retry.Enqueue(notifier.Name(), target, n, err); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// Start retries queued deliveries until the process ends
+func (d *Dispatcher) Start() {
+	go func() {
+		for now := range time.Tick(time.Second) {
+			for _, delivery := range d.retry.Due(now) {
+				d.redeliver(delivery)
+			}
+			metrics.Set("sentinel_retry_queue_deliveries", nil, float64(d.retry.Len()))
+		}
+	}()
+}
+
+// notify delivers n through notifier, only to target if not empty, counting the outcome.
+// The message is rendered from the notifier's template, if any, on a copy of n.
+func (d *Dispatcher) notify(notifier Notifier, target string, n *Notification) error {
+	if t, ok := d.templates[notifier.Name()]; ok {
+		msg, err := RenderMessage(t, n)
+		if err != nil {
+			log.WithFields(log.Fields{"notifier": notifier.Name(), "error": err}).Warn("Message template failed, keeping default message")
+		} else {
+			c := *n
+			c.Message = msg
+			n = &c
+		}
+	}
+	if d.Recorder != nil {
+		d.Recorder.Record(notifier, n)
+		return nil
+	}
+	var err error
+	if target != "" {
+		err = notifier.(TargetNotifier).NotifyTarget(target, n)
+	} else {
+		err = notifier.Notify(n)
+	}
+	if err != nil {
+		metrics.Inc("sentinel_notifications_failed_total", Labels{"notifier": notifier.Name()})
+	} else {
+		metrics.Inc("sentinel_notifications_sent_total", Labels{"notifier": notifier.Name()})
+	}
+	return err
+}
+
+// TargetNotifier is implemented by notifiers delivering to several independent targets, e.g. WebhookNotifier.
+// The dispatcher notifies and retries each target on its own, so targets that succeeded are not notified again.
+type TargetNotifier interface {
+	Targets() []string
+	NotifyTarget(target string, n *Notification) error
+}
+
+// EventForwarder is implemented by notifiers that also take the raw events matched by rules, e.g. SyslogNotifier
+type EventForwarder interface {
+	ForwardsEvents() bool
+	Forward(cluster string, m Event) error
+}
+
+// forwardedClass class of the recordings of forwarded events in a dry run
+const forwardedClass = "forwarded"
+
+// Forward hands the event m matched by a rule to every notifier forwarding events, a dry run records them
+func (d *Dispatcher) Forward(cluster string, m Event) {
+	for _, notifier := range d.notifiers {
+		f, ok := notifier.(EventForwarder)
+		if !ok || !f.ForwardsEvents() {
+			continue
+		}
+		if d.Recorder != nil {
+			d.Recorder.Record(notifier, &Notification{Class: forwardedClass, Severity: "info", Cluster: cluster, Event: m})
+			continue
+		}
+		if err := f.Forward(cluster, m); err != nil {
+			log.WithFields(log.Fields{"notifier": notifier.Name(), "error": err}).Warn("Event forwarding failed")
+		}
+	}
+}
+
+// Abandoner is implemented by notifiers retrying by themselves, e.g. SMTPNotifier,
+// they report the notifications they gave up on to be dispatched as undeliverable
+type Abandoner interface {
+	OnAbandon(report func(n *Notification, attempts int, err error))
+}
+
+// Flusher is implemented by notifiers that batch notifications, e.g. SMTPNotifier
+type Flusher interface {
+	Flush()
+}
+
+// Flush delivers the notifications batched by notifiers, e.g. before the process ends
+func (d *Dispatcher) Flush() {
+	for _, notifier := range d.notifiers {
+		if f, ok := notifier.(Flusher); ok {
+			f.Flush()
+		}
+	}
+}
+
+func (d *Dispatcher) redeliver(delivery *Delivery) {
+	notifier, ok := d.notifiers[delivery.Notifier]
+	if !ok {
+		log.WithFields(log.Fields{"delivery": delivery.ID, "notifier": delivery.Notifier}).Warn("Retry: notifier no longer configured, dropping delivery")
+		d.retry.Done(delivery)
+		return
+	}
+	if delivery.Target != "" && !hasTarget(notifier, delivery.Target) {
+		log.WithFields(log.Fields{"delivery": delivery.ID, "notifier": delivery.Notifier, "target": delivery.Target}).Warn("Retry: target no longer configured, dropping delivery")
+		d.retry.Done(delivery)
+		return
+	}
+	err := d.notify(notifier, delivery.Target, delivery.Notification)
+	if err == nil {
+		log.WithFields(log.Fields{"delivery": delivery.ID, "notifier": delivery.Notifier, "target": delivery.Target, "attempts": delivery.Attempts + 1}).Info("Retry delivered")
+		d.retry.Done(delivery)
+		return
+	}
+	if _, ok := err.(PermanentError); ok {
+		delivery.Attempts++
+	} else if d.retry.Retry(delivery, err) {
+		return
+	}
+	d.retry.Done(delivery)
+	log.WithFields(log.Fields{"delivery": delivery.ID, "notifier": delivery.Notifier, "target": delivery.Target, "attempts": delivery.Attempts, "error": err}).Error("Delivery abandoned")
+	d.undeliverable(delivery.Notifier, delivery.Notification, delivery.Attempts, err)
+}
+
+// undeliverable reports that notifier gave up on n after attempts, undeliverable reports themselves are only counted
+func (d *Dispatcher) undeliverable(notifier string, n *Notification, attempts int, err error) {
+	metrics.Inc("sentinel_notifications_abandoned_total", Labels{"notifier": notifier})
+	if n.Class == ClassUndeliverable {
+		return
+	}
+	d.Dispatch(&Notification{
+		Class:    ClassUndeliverable,
+		Severity: "error",
+		Cluster:  n.Cluster,
+		Endpoint: n.Endpoint,
+		Message:  fmt.Sprintf("[%s] %s notification via %s undeliverable after %d attempts: %s", n.Cluster, n.Class, notifier, attempts, err),
+		Event:    n.Event,
+		Members:  []*Notification{n},
+	})
+}
+
+func hasTarget(notifier Notifier, target string) bool {
+	if t, ok := notifier.(TargetNotifier); ok {
+		for _, configured := range t.Targets() {
+			if configured == target {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"text/template"
+
+	log "github.com/Sirupsen/logrus"
+	bn "github.com/larskluge/babl/bablnaming"
+)
+
+// BablNotifier runs a babl module through the babl CLI, the message is piped to stdin.
+// Endpoint, module and env values are templates of the BablVars of the notification,
+// e.g. MODULE: "{{.MODULE}}" or endpoint: "{{.CLUSTER}}.babl.sh:4445".
+type BablNotifier struct {
+	name     string
+	bin      string
+	endpoint *template.Template
+	module   *template.Template
+	env      map[string]*template.Template
+}
+
+func NewBablNotifier(name string, cfg NotifierConfig) (*BablNotifier, error) {
+	bin := cfg.Bin
+	if bin == "" {
+		bin = "/bin/babl"
+	}
+	b := &BablNotifier{name: name, bin: bin, env: map[string]*template.Template{}}
+	var err error
+	if b.endpoint, err = parseBablTemplate(name, "endpoint", cfg.Endpoint); err != nil {
+		return nil, err
+	}
+	if b.module, err = parseBablTemplate(name, "module", cfg.Module); err != nil {
+		return nil, err
+	}
+	for k, v := range cfg.Env {
+		if b.env[k], err = parseBablTemplate(name, "env "+k, v); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// parseBablTemplate parses text and executes it once on empty vars to reject unknown fields at load time
+func parseBablTemplate(notifier, field, text string) (*template.Template, error) {
+	t, err := template.New(field).Option("missingkey=error").Parse(text)
+	if err == nil {
+		err = t.Execute(&bytes.Buffer{}, BablVars(&Notification{}))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("notifier %q: %s: %s", notifier, field, err)
+	}
+	return t, nil
+}
+
+// BablVars fields of n available to the templates of babl notifiers
+func BablVars(n *Notification) map[string]string {
+	m := n.Event
+	a := m.Actor.Attributes
+	image := a.Image
+	if image == "" {
+		image = m.From
+	}
+	return map[string]string{
+		"CLUSTER":     n.Cluster,
+		"ENDPOINT":    n.Endpoint,
+		"CLASS":       n.Class,
+		"SEVERITY":    n.Severity,
+		"SERVICE":     a.ComDockerSwarmServiceName,
+		"MODULE":      bn.ServiceToModule(a.ComDockerSwarmServiceName),
+		"TASK":        a.ComDockerSwarmTaskName,
+		"INSTANCE_ID": m.ID,
+		"NODE":        m.NodeID(),
+		"IMAGE":       image,
+		"STATUS":      m.Status,
+		"EXIT_CODE":   a.ExitCode,
+		"EXIT_CLASS":  m.ExitClass,
+	}
+}
+
+func (b *BablNotifier) Name() string {
+	return b.name
+}
+
+// babl -c 192.168.99.100:4445 babl/oom-restart -e MODULE=larskluge/image-resize -e INSTANCE_ID=7b43d4142a24
+func (b *BablNotifier) Notify(n *Notification) error {
+	args, err := b.args(n)
+	if err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{"notifier": b.name, "args": args}).Info("babl")
+	cmd := exec.Command(b.bin, args...)
+	cmd.Stdin = strings.NewReader(n.Message)
+	return cmd.Run()
+}
+
+func (b *BablNotifier) Describe(n *Notification) (string, []string) {
+	args, err := b.args(n)
+	if err != nil {
+		return b.bin, []string{"error: " + err.Error()}
+	}
+	return b.bin, args
+}
+
+func (b *BablNotifier) args(n *Notification) ([]string, error) {
+	vars := BablVars(n)
+	endpoint, err := render(b.endpoint, vars)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint == "" {
+		endpoint = n.Endpoint
+	}
+	module, err := render(b.module, vars)
+	if err != nil {
+		return nil, err
+	}
+	env := map[string]string{}
+	for k, t := range b.env {
+		if env[k], err = render(t, vars); err != nil {
+			return nil, err
+		}
+	}
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	args := []string{"-c", endpoint, module}
+	for _, k := range keys {
+		args = append(args, "-e", k+"="+env[k])
+	}
+	return args, nil
+}
+
+func render(t *template.Template, vars map[string]string) (string, error) {
+	var b bytes.Buffer
+	if err := t.Execute(&b, vars); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/Shopify/sarama"
+	log "github.com/Sirupsen/logrus"
+	"github.com/larskluge/babl-server/kafka"
+)
+
+// KafkaNotifier produces notifications as versioned Alert documents to a Kafka topic, keyed by service name
+type KafkaNotifier struct {
+	name     string
+	topic    string
+	producer *sarama.SyncProducer
+}
+
+func NewKafkaNotifier(name string, cfg NotifierConfig) *KafkaNotifier {
+	topic := cfg.Topic
+	if topic == "" {
+		topic = TopicAlerts
+	}
+	return &KafkaNotifier{name: name, topic: topic, producer: kafka.NewProducer(cfg.Brokers, "sentinel")}
+}
+
+func (k *KafkaNotifier) Name() string {
+	return k.name
+}
+
+func (k *KafkaNotifier) Notify(n *Notification) error {
+	alert := NewAlert(n)
+	value, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	msg := &sarama.ProducerMessage{
+		Topic: k.topic,
+		Key:   sarama.StringEncoder(alert.Key()),
+		Value: sarama.ByteEncoder(value),
+	}
+	partition, offset, err := (*k.producer).SendMessage(msg)
+	if err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{"notifier": k.name, "topic": k.topic, "partition": partition, "offset": offset}).Info("Notification produced")
+	return nil
+}
+
+func (k *KafkaNotifier) Describe(n *Notification) (string, []string) {
+	return "kafka:" + k.topic, []string{"key=" + NewAlert(n).Key()}
+}
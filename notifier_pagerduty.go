@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// pagerDutyEvents default Events API v2 endpoint, the url can point to a local mock instead
+const pagerDutyEvents = "https://events.pagerduty.com/v2/enqueue"
+
+// PagerDuty event actions
+const (
+	PagerDutyTrigger     = "trigger"
+	PagerDutyAcknowledge = "acknowledge"
+	PagerDutyResolve     = "resolve"
+)
+
+// PagerDutyNotifier pages through the PagerDuty Events API v2, deduplicating by cluster and service.
+// Notifications of at least MinSeverity trigger an incident, further failures within the open sentinel
+// incident of the service acknowledge it, and the recovery of the service from flapping or the resolution
+// of its sentinel incident resolves it. Acknowledges and resolves are always sent, PagerDuty ignores them
+// for dedup keys without an open incident, so incidents triggered before a restart resolve too.
+type PagerDutyNotifier struct {
+	name        string
+	url         string
+	routingKey  string
+	minSeverity string
+	client      *http.Client
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string    `json:"summary"`
+	Source        string    `json:"source"`
+	Severity      string    `json:"severity"`
+	Timestamp     time.Time `json:"timestamp"`
+	Component     string    `json:"component,omitempty"`
+	Group         string    `json:"group,omitempty"`
+	Class         string    `json:"class,omitempty"`
+	CustomDetails *Alert    `json:"custom_details,omitempty"`
+}
+
+func NewPagerDutyNotifier(name string, cfg NotifierConfig) (*PagerDutyNotifier, error) {
+	if cfg.RoutingKey == "" {
+		return nil, fmt.Errorf("notifier %q: pagerduty without routing_key", name)
+	}
+	url := cfg.URL
+	if url == "" {
+		url = pagerDutyEvents
+	}
+	minSeverity := cfg.MinSeverity
+	if minSeverity == "" {
+		minSeverity = "error"
+	}
+	if !validSeverity(minSeverity) {
+		return nil, fmt.Errorf("notifier %q: unknown min_severity %q", name, minSeverity)
+	}
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	return &PagerDutyNotifier{name: name, url: url, routingKey: cfg.RoutingKey, minSeverity: minSeverity, client: &http.Client{Timeout: timeout}}, nil
+}
+
+func (p *PagerDutyNotifier) Name() string {
+	return p.name
+}
+
+func (p *PagerDutyNotifier) Notify(n *Notification) error {
+	alert := NewAlert(n)
+	event := p.event(alert)
+	if event == nil {
+		log.WithFields(log.Fields{"notifier": p.name, "class": alert.Class, "severity": alert.Severity, "key": alert.Key()}).Debug("PagerDuty: nothing to page")
+		return nil
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	res, err := p.client.Post(p.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		data, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("pagerduty %s: %s: %s", event.EventAction, res.Status, data)
+	}
+	log.WithFields(log.Fields{"notifier": p.name, "action": event.EventAction, "dedup_key": event.DedupKey}).Info("PagerDuty event sent")
+	return nil
+}
+
+// event to send for alert, nil if it neither pages, acknowledges nor resolves
+func (p *PagerDutyNotifier) event(alert *Alert) *pagerDutyEvent {
+	e := &pagerDutyEvent{RoutingKey: p.routingKey, DedupKey: alert.Cluster + "/" + alert.Key()}
+	switch {
+	case alert.Class == ClassRecovered || alert.Class == ClassIncidentResolved:
+		e.EventAction = PagerDutyResolve
+	case alert.Class == ClassIncidentUpdated:
+		e.EventAction = PagerDutyAcknowledge
+	case severityRank(alert.Severity) >= severityRank(p.minSeverity):
+		summary := alert.Message
+		if summary == "" {
+			// Events v2 rejects triggers without summary
+			summary = fmt.Sprintf("[%s] %s %s %s", alert.Cluster, alert.Severity, alert.Class, alert.Key())
+		}
+		e.EventAction = PagerDutyTrigger
+		e.Payload = &pagerDutyPayload{
+			Summary:       summary,
+			Source:        alert.Cluster,
+			Severity:      pagerDutySeverity(alert.Severity),
+			Timestamp:     alert.EventTime,
+			Component:     alert.Module,
+			Group:         alert.Service,
+			Class:         alert.Class,
+			CustomDetails: alert,
+		}
+		if e.Payload.Source == "" {
+			e.Payload.Source = "sentinel"
+		}
+	default:
+		return nil
+	}
+	return e
+}
+
+// pagerDutySeverity maps a rule severity to one of PagerDuty's critical, error, warning or info
+func pagerDutySeverity(severity string) string {
+	if validSeverity(severity) {
+		return severity
+	}
+	return "error"
+}
+
+func (p *PagerDutyNotifier) Describe(n *Notification) (string, []string) {
+	e := p.event(NewAlert(n))
+	if e == nil {
+		return p.url, []string{"skip"}
+	}
+	return p.url, []string{e.EventAction, "dedup_key=" + e.DedupKey}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PagerDutyNotifier", func() {
+	var (
+		server *httptest.Server
+		events []pagerDutyEvent
+		p      *PagerDutyNotifier
+	)
+
+	BeforeEach(func() {
+		events = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var e pagerDutyEvent
+			Expect(json.NewDecoder(r.Body).Decode(&e)).To(Succeed())
+			events = append(events, e)
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		var err error
+		p, err = NewPagerDutyNotifier("pd", NotifierConfig{URL: server.URL, RoutingKey: "key"})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	notification := func(class, severity, status string) *Notification {
+		return &Notification{Class: class, Severity: severity, Cluster: "prod", Message: "db is down", Event: containerEvent(status, "a", "db.1.x", "1", time.Unix(1500000000, 0))}
+	}
+
+	It("triggers at the minimum severity, deduplicated by cluster and service", func() {
+		Expect(p.Notify(notification(ClassEvent, "error", "die"))).To(Succeed())
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].EventAction).To(Equal(PagerDutyTrigger))
+		Expect(events[0].RoutingKey).To(Equal("key"))
+		Expect(events[0].DedupKey).To(Equal("prod/db"))
+		Expect(events[0].Payload.Summary).To(Equal("db is down"))
+		Expect(events[0].Payload.Severity).To(Equal("error"))
+	})
+
+	It("sends nothing below the minimum severity, nor for starts", func() {
+		Expect(p.Notify(notification(ClassEvent, "warning", "die"))).To(Succeed())
+		Expect(p.Notify(notification(ClassEvent, "info", "start"))).To(Succeed())
+		Expect(events).To(BeEmpty())
+	})
+
+	It("resolves on recovery and incident resolution, even without a trigger of its own", func() {
+		Expect(p.Notify(notification(ClassIncidentResolved, "info", "start"))).To(Succeed())
+		Expect(p.Notify(notification(ClassRecovered, "info", "start"))).To(Succeed())
+		Expect(events).To(HaveLen(2))
+		for _, e := range events {
+			Expect(e.EventAction).To(Equal(PagerDutyResolve))
+			Expect(e.DedupKey).To(Equal("prod/db"))
+			Expect(e.Payload).To(BeNil())
+		}
+	})
+
+	It("pages ooms as created by the pipeline", func() {
+		m := containerEvent("oom", "7b43d4142a24", "larskluge--image-resize.1.x", "", time.Unix(1500000000, 0))
+		n := (&Pipeline{Cluster: "prod"}).oomNotification(m)
+		n.Severity = "critical"
+		Expect(p.Notify(n)).To(Succeed())
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].EventAction).To(Equal(PagerDutyTrigger))
+		Expect(events[0].Payload.Summary).To(Equal("[prod] larskluge/image-resize instance 7b43d4142a24 --> oom"))
+	})
+
+	It("generates a summary for notifications without message", func() {
+		n := notification(ClassEvent, "error", "die")
+		n.Message = ""
+		Expect(p.Notify(n)).To(Succeed())
+		Expect(events[0].Payload.Summary).To(Equal("[prod] error event db"))
+	})
+
+	It("acknowledges further failures within an open incident", func() {
+		Expect(p.Notify(notification(ClassIncidentOpened, "error", "die"))).To(Succeed())
+		Expect(p.Notify(notification(ClassIncidentUpdated, "error", "die"))).To(Succeed())
+		Expect(events).To(HaveLen(2))
+		Expect(events[0].EventAction).To(Equal(PagerDutyTrigger))
+		Expect(events[1].EventAction).To(Equal(PagerDutyAcknowledge))
+		Expect(events[1].DedupKey).To(Equal(events[0].DedupKey))
+		Expect(events[1].Payload).To(BeNil())
+	})
+
+	It("fails on rejected events", func() {
+		server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"status":"invalid event"}`, http.StatusBadRequest)
+		})
+		Expect(p.Notify(notification(ClassOom, "critical", "oom"))).To(MatchError(ContainSubstring("400")))
+	})
+})
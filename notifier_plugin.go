@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// PluginNotifier delivers notifications through a long-running plugin process, so delivery
+// channels can be added in any language. The plugin protocol is newline-delimited JSON:
+//
+// Sentinel writes one request per alert to the plugin's stdin, e.g.
+//
+//	{"id":"42","alert":{"version":1,"class":"oom","severity":"critical","cluster":"production",...}}
+//
+// where alert is the Alert document. The plugin answers each request on stdout with its id,
+// either acknowledging delivery or reporting why it failed:
+//
+//	{"id":"42","ok":true}
+//	{"id":"42","error":"smtp: connection refused"}
+//
+// Requests are sent one at a time, the next follows once the previous one has been answered.
+// Failed or unanswered requests are retried like those of any notifier. Lines on the plugin's
+// stderr are logged. A plugin that exits or does not answer within the timeout is (re)started
+// with backoff; it should not exit on its own.
+type PluginNotifier struct {
+	name    string
+	command []string
+	env     []string
+	timeout time.Duration
+
+	mu   sync.Mutex // one request at a time
+	seq  int
+	pmu  sync.Mutex
+	proc *pluginProcess
+}
+
+type pluginProcess struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	replies chan pluginReply
+	done    chan struct{} // closed once stdout is closed, i.e. the plugin exited
+	logged  chan struct{} // closed once stderr is read to the end, cmd.Wait closes the pipe
+}
+
+type pluginRequest struct {
+	ID    string `json:"id"`
+	Alert *Alert `json:"alert"`
+}
+
+type pluginReply struct {
+	ID    string `json:"id"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+}
+
+func NewPluginNotifier(name string, cfg NotifierConfig) (*PluginNotifier, error) {
+	if len(cfg.Command) == 0 {
+		return nil, fmt.Errorf("notifier %q: plugin without command", name)
+	}
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	env := os.Environ()
+	for k, v := range cfg.Env {
+		env = append(env, k+"="+v)
+	}
+	p := &PluginNotifier{name: name, command: cfg.Command, env: env, timeout: timeout}
+	proc, err := p.start()
+	if err != nil {
+		return nil, fmt.Errorf("notifier %q: %s", name, err)
+	}
+	p.proc = proc
+	go p.supervise(proc)
+	return p, nil
+}
+
+func (p *PluginNotifier) Name() string {
+	return p.name
+}
+
+func (p *PluginNotifier) Notify(n *Notification) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pmu.Lock()
+	proc := p.proc
+	p.pmu.Unlock()
+	if proc == nil {
+		return fmt.Errorf("plugin %s: not running", p.name)
+	}
+
+	p.seq++
+	req := pluginRequest{ID: strconv.Itoa(p.seq), Alert: NewAlert(n)}
+	line, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	if _, err := proc.stdin.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("plugin %s: %s", p.name, err)
+	}
+	timeout := time.After(p.timeout)
+	for {
+		select {
+		case reply := <-proc.replies:
+			if reply.ID != req.ID {
+				log.WithFields(log.Fields{"plugin": p.name, "id": reply.ID}).Warn("Plugin: ignoring reply to another request")
+				continue
+			}
+			if !reply.OK {
+				if reply.Error == "" {
+					reply.Error = "not acknowledged"
+				}
+				return fmt.Errorf("plugin %s: %s", p.name, reply.Error)
+			}
+			return nil
+		case <-proc.done:
+			return fmt.Errorf("plugin %s: exited before answering", p.name)
+		case <-timeout:
+			proc.cmd.Process.Kill()
+			return fmt.Errorf("plugin %s: no answer within %s, restarting", p.name, p.timeout)
+		}
+	}
+}
+
+// supervise keeps the plugin running, restarting it with exponential backoff after it exits
+func (p *PluginNotifier) supervise(proc *pluginProcess) {
+	backoff := time.Second
+	for {
+		started := time.Now()
+		log.WithFields(log.Fields{"plugin": p.name, "command": p.command, "pid": proc.cmd.Process.Pid}).Info("Plugin started")
+		p.pmu.Lock()
+		p.proc = proc
+		p.pmu.Unlock()
+		<-proc.done
+		<-proc.logged
+		err := proc.cmd.Wait()
+		p.pmu.Lock()
+		p.proc = nil
+		p.pmu.Unlock()
+		log.WithFields(log.Fields{"plugin": p.name, "error": err}).Warn("Plugin exited")
+		if time.Since(started) > time.Minute {
+			backoff = time.Second
+		}
+		for {
+			time.Sleep(backoff)
+			if backoff < time.Minute {
+				backoff *= 2
+			}
+			if proc, err = p.start(); err == nil {
+				break
+			}
+			log.WithFields(log.Fields{"plugin": p.name, "command": p.command, "error": err}).Error("Plugin failed to start")
+		}
+	}
+}
+
+func (p *PluginNotifier) start() (*pluginProcess, error) {
+	cmd := exec.Command(p.command[0], p.command[1:]...)
+	cmd.Env = p.env
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	proc := &pluginProcess{cmd: cmd, stdin: stdin, replies: make(chan pluginReply, 1), done: make(chan struct{}), logged: make(chan struct{})}
+	go p.logStderr(proc, stderr)
+	go p.readReplies(proc, stdout)
+	return proc, nil
+}
+
+// readReplies decodes the plugin's stdout, a reply nobody waits for anymore is dropped
+func (p *PluginNotifier) readReplies(proc *pluginProcess, stdout io.Reader) {
+	defer close(proc.done)
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		var reply pluginReply
+		if err := json.Unmarshal(scanner.Bytes(), &reply); err != nil {
+			log.WithFields(log.Fields{"plugin": p.name, "line": scanner.Text(), "error": err}).Warn("Plugin: undecodable reply")
+			continue
+		}
+		select {
+		case proc.replies <- reply:
+		default:
+			log.WithFields(log.Fields{"plugin": p.name, "id": reply.ID}).Warn("Plugin: dropping late reply")
+		}
+	}
+}
+
+func (p *PluginNotifier) logStderr(proc *pluginProcess, stderr io.Reader) {
+	defer close(proc.logged)
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		log.WithFields(log.Fields{"plugin": p.name}).Info(scanner.Text())
+	}
+}
+
+func (p *PluginNotifier) Describe(n *Notification) (string, []string) {
+	return p.command[0], p.command[1:]
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// testPlugin acknowledges every request, except for the messages fail, hang and exit
+const testPlugin = `#!/bin/sh
+echo started >> "$STARTS"
+while read -r line; do
+	id=$(printf '%s' "$line" | sed 's/^{"id":"\([^"]*\)".*/\1/')
+	case "$line" in
+	*'"message":"fail"'*) printf '{"id":"%s","error":"rejected"}\n' "$id" ;;
+	*'"message":"hang"'*) read -r ignored ;;
+	*'"message":"exit"'*) exit 0 ;;
+	*) printf '{"id":"%s","ok":true}\n' "$id" ;;
+	esac
+done
+`
+
+var _ = Describe("PluginNotifier", func() {
+	var (
+		dir    string
+		starts string
+		p      *PluginNotifier
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "sentinel-plugin")
+		Expect(err).NotTo(HaveOccurred())
+		script := filepath.Join(dir, "plugin.sh")
+		Expect(ioutil.WriteFile(script, []byte(testPlugin), 0755)).To(Succeed())
+		starts = filepath.Join(dir, "starts")
+		p, err = NewPluginNotifier("plug", NotifierConfig{Command: []string{script}, Env: map[string]string{"STARTS": starts}, Timeout: 500 * time.Millisecond})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	notification := func(msg string) *Notification {
+		return &Notification{Class: ClassEvent, Severity: "warning", Cluster: "prod", Message: msg, Event: containerEvent("die", "a", "db.1.x", "1", time.Unix(1500000000, 0))}
+	}
+
+	started := func() int {
+		data, _ := ioutil.ReadFile(starts)
+		return strings.Count(string(data), "started")
+	}
+
+	It("delivers acknowledged requests", func() {
+		Expect(p.Notify(notification("db died"))).To(Succeed())
+		Expect(p.Notify(notification("db died again"))).To(Succeed())
+		Expect(started()).To(Equal(1))
+	})
+
+	It("fails with the error the plugin replied", func() {
+		Expect(p.Notify(notification("fail"))).To(MatchError("plugin plug: rejected"))
+		Expect(p.Notify(notification("db died"))).To(Succeed())
+	})
+
+	It("kills a plugin not answering within the timeout and restarts it", func() {
+		Expect(p.Notify(notification("hang"))).To(MatchError(ContainSubstring("no answer within")))
+		Eventually(started, 5*time.Second, 50*time.Millisecond).Should(Equal(2))
+		Eventually(func() error { return p.Notify(notification("db died")) }, 5*time.Second, 100*time.Millisecond).Should(Succeed())
+	})
+
+	It("restarts a plugin exiting on its own", func() {
+		Expect(p.Notify(notification("exit"))).To(MatchError(ContainSubstring("exited before answering")))
+		Eventually(started, 5*time.Second, 50*time.Millisecond).Should(Equal(2))
+		Eventually(func() error { return p.Notify(notification("db died")) }, 5*time.Second, 100*time.Millisecond).Should(Succeed())
+	})
+})
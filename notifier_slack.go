@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// slackAPI posts messages with a bot token, needed for threading since incoming webhooks return no message ts
+const slackAPI = "https://slack.com/api/chat.postMessage"
+
+// slackThreadTTL after which alerts of a service start a new thread
+const slackThreadTTL = 24 * time.Hour
+
+// slackColors attachment colour per severity, recoveries are green
+var slackColors = map[string]string{
+	"info":     "#439FE0",
+	"warning":  "#DAA038",
+	"error":    "#D00000",
+	"critical": "#7B0000",
+}
+
+// SlackNotifier posts notifications as colour-coded Slack attachments.
+// With a url it speaks the incoming-webhook format, with a token it uses chat.postMessage
+// and threads the alerts of each service below the first one.
+type SlackNotifier struct {
+	name    string
+	url     string
+	token   string
+	channel string
+	client  *http.Client
+
+	mu      sync.Mutex
+	threads map[string]slackThread
+}
+
+type slackThread struct {
+	ts      string
+	updated time.Time
+}
+
+type slackMessage struct {
+	Channel     string            `json:"channel,omitempty"`
+	Text        string            `json:"text"`
+	ThreadTS    string            `json:"thread_ts,omitempty"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+type slackAttachment struct {
+	Fallback string       `json:"fallback"`
+	Color    string       `json:"color"`
+	Title    string       `json:"title"`
+	Text     string       `json:"text"`
+	Fields   []slackField `json:"fields,omitempty"`
+	Footer   string       `json:"footer"`
+	TS       int64        `json:"ts"`
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+func NewSlackNotifier(name string, cfg NotifierConfig) (*SlackNotifier, error) {
+	s := &SlackNotifier{name: name, url: cfg.URL, token: cfg.Token, channel: cfg.Channel, threads: map[string]slackThread{}}
+	if s.token != "" {
+		if s.channel == "" {
+			return nil, fmt.Errorf("notifier %q: slack token without channel", name)
+		}
+		if s.url == "" {
+			s.url = slackAPI
+		}
+	} else if s.url == "" {
+		return nil, fmt.Errorf("notifier %q: slack needs a webhook url or a token", name)
+	}
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	s.client = &http.Client{Timeout: timeout}
+	return s, nil
+}
+
+func (s *SlackNotifier) Name() string {
+	return s.name
+}
+
+func (s *SlackNotifier) Notify(n *Notification) error {
+	alert := NewAlert(n)
+	msg := s.message(alert)
+	thread := alert.Cluster + "/" + alert.Key()
+	if s.token != "" {
+		msg.ThreadTS = s.thread(thread)
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	data, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("slack: %s: %s", res.Status, data)
+	}
+	if s.token != "" {
+		var reply struct {
+			OK    bool   `json:"ok"`
+			Error string `json:"error"`
+			TS    string `json:"ts"`
+		}
+		if err := json.Unmarshal(data, &reply); err != nil {
+			return fmt.Errorf("slack: %s", err)
+		}
+		if !reply.OK {
+			return fmt.Errorf("slack: %s", reply.Error)
+		}
+		if msg.ThreadTS == "" {
+			s.startThread(thread, reply.TS)
+		}
+	}
+	log.WithFields(log.Fields{"notifier": s.name, "channel": s.channel, "thread": msg.ThreadTS}).Info("Slack message posted")
+	return nil
+}
+
+// thread ts of the open thread of key, empty if a new one is to be started
+func (s *SlackNotifier) thread(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.threads[key]
+	if !ok || time.Since(t.updated) > slackThreadTTL {
+		delete(s.threads, key)
+		return ""
+	}
+	t.updated = time.Now()
+	s.threads[key] = t
+	return t.ts
+}
+
+func (s *SlackNotifier) startThread(key, ts string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.threads[key] = slackThread{ts: ts, updated: time.Now()}
+}
+
+func (s *SlackNotifier) message(alert *Alert) slackMessage {
+	color := slackColors[alert.Severity]
+	if alert.Class == ClassRecovered || alert.Class == ClassIncidentResolved {
+		color = "good"
+	}
+	title := fmt.Sprintf("%s %s", alert.Severity, alert.Class)
+	if alert.Service != "" {
+		title += ": " + alert.Service
+	}
+	var fields []slackField
+	for _, f := range []struct{ title, value string }{
+		{"Cluster", alert.Cluster},
+		{"Module", alert.Module},
+		{"Node", alert.Node},
+		{"Image", alert.Image},
+		{"Exit code", alert.ExitCode},
+		{"Exit class", alert.ExitClass},
+	} {
+		if f.value != "" {
+			fields = append(fields, slackField{Title: f.title, Value: f.value, Short: true})
+		}
+	}
+	footer := "sentinel"
+	if alert.Rule != "" {
+		footer += " " + alert.Rule
+	}
+	// the top-level text is shown in notifications, the message itself only once in the attachment
+	return slackMessage{
+		Channel: s.channel,
+		Text:    fmt.Sprintf("[%s] %s", alert.Cluster, title),
+		Attachments: []slackAttachment{{
+			Fallback: alert.Message,
+			Color:    color,
+			Title:    title,
+			Text:     alert.Message,
+			Fields:   fields,
+			Footer:   footer,
+			TS:       alert.EventTime.Unix(),
+		}},
+	}
+}
+
+func (s *SlackNotifier) Describe(n *Notification) (string, []string) {
+	alert := NewAlert(n)
+	args := []string{"color=" + s.message(alert).Attachments[0].Color}
+	if s.token != "" {
+		args = append(args, "channel="+s.channel, "thread="+alert.Cluster+"/"+alert.Key())
+	}
+	return s.url, args
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SlackNotifier", func() {
+	var (
+		server   *httptest.Server
+		messages []slackMessage
+		auth     []string
+	)
+
+	BeforeEach(func() {
+		messages = nil
+		auth = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var msg slackMessage
+			Expect(json.NewDecoder(r.Body).Decode(&msg)).To(Succeed())
+			messages = append(messages, msg)
+			auth = append(auth, r.Header.Get("Authorization"))
+			w.Write([]byte(`{"ok":true,"ts":"1500000000.000100"}`))
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	notification := func(class string) *Notification {
+		return &Notification{Class: class, Severity: "critical", Cluster: "prod", Message: "db.1 ran out of memory", Event: containerEvent("oom", "a", "db.1.x", "137", time.Unix(1500000000, 0))}
+	}
+
+	It("posts the message once, in the attachment below a short summary", func() {
+		s, err := NewSlackNotifier("slack", NotifierConfig{URL: server.URL})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.Notify(notification(ClassOom))).To(Succeed())
+
+		Expect(messages).To(HaveLen(1))
+		msg := messages[0]
+		Expect(msg.Text).To(Equal("[prod] critical oom: db"))
+		Expect(msg.Attachments).To(HaveLen(1))
+		Expect(msg.Attachments[0].Text).To(Equal("db.1 ran out of memory"))
+		Expect(msg.Attachments[0].Color).To(Equal(slackColors["critical"]))
+		Expect(msg.ThreadTS).To(BeEmpty())
+		Expect(auth[0]).To(BeEmpty())
+	})
+
+	It("threads the alerts of a service with a token", func() {
+		s, err := NewSlackNotifier("slack", NotifierConfig{URL: server.URL, Token: "xoxb", Channel: "#ops"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.Notify(notification(ClassOom))).To(Succeed())
+		Expect(s.Notify(notification(ClassRecovered))).To(Succeed())
+
+		Expect(messages).To(HaveLen(2))
+		Expect(messages[0].Channel).To(Equal("#ops"))
+		Expect(messages[0].ThreadTS).To(BeEmpty())
+		Expect(messages[1].ThreadTS).To(Equal("1500000000.000100"))
+		Expect(messages[1].Attachments[0].Color).To(Equal("good"))
+		Expect(auth).To(ConsistOf("Bearer xoxb", "Bearer xoxb"))
+	})
+})
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// defaultMailText plain-text body of a batch unless a text template is configured
+const defaultMailText = `{{len .Alerts}} sentinel alert(s) between {{time "15:04:05" .Since.UnixNano}} and {{time "15:04:05 MST" .Until.UnixNano}}:
+{{range .Alerts}}
+[{{.Severity}}] {{.Cluster}} {{.Class}}: {{.Message}}{{end}}
+`
+
+// defaultMailSubject subject of a batch unless a subject template is configured
+const defaultMailSubject = `[sentinel] {{len .Alerts}} alert(s){{with .Clusters}} on {{join ", " .}}{{end}}`
+
+// mailMaxAttempts flushes a batch is attempted before its alerts are reported undeliverable
+const mailMaxAttempts = 5
+
+// MailBatch what subject, text and html templates of the smtp notifier are executed on
+type MailBatch struct {
+	Recipient string
+	Clusters  []string
+	Alerts    []MessageData
+	Since     time.Time
+	Until     time.Time
+
+	attempts int
+}
+
+// SMTPNotifier mails notifications in batches, at most one mail per interval and recipient.
+// Recipients default to To and can be set per notification class, i.e. per route.
+// Mails that cannot be sent stay queued for the next interval, alerts queued meanwhile join them,
+// until mailMaxAttempts flushes failed and the alerts are reported undeliverable.
+// Batches bypass the retry outbox: they are kept in memory only and lost if the process dies
+// before they could be sent, a regular shutdown flushes them.
+type SMTPNotifier struct {
+	name       string
+	addr       string
+	startTLS   bool
+	auth       smtp.Auth
+	from       string
+	to         []string
+	recipients map[string][]string
+	interval   time.Duration
+	subject    *template.Template
+	text       *template.Template
+	html       *htmltemplate.Template
+
+	mu      sync.Mutex
+	pending map[string]*MailBatch
+	abandon func(n *Notification, attempts int, err error)
+}
+
+func NewSMTPNotifier(name string, cfg NotifierConfig) (*SMTPNotifier, error) {
+	if cfg.Addr == "" || cfg.From == "" {
+		return nil, fmt.Errorf("notifier %q: smtp needs addr and from", name)
+	}
+	if len(cfg.To) == 0 {
+		return nil, fmt.Errorf("notifier %q: smtp needs to, for all classes without recipients of their own", name)
+	}
+	for class, r := range cfg.Recipients {
+		if len(r) == 0 {
+			return nil, fmt.Errorf("notifier %q: no recipients for class %q", name, class)
+		}
+	}
+	host, _, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("notifier %q: addr: %s", name, err)
+	}
+	s := &SMTPNotifier{name: name, addr: cfg.Addr, startTLS: cfg.StartTLS, from: cfg.From, to: cfg.To, recipients: cfg.Recipients, interval: cfg.Interval, pending: map[string]*MailBatch{}}
+	if s.interval == 0 {
+		s.interval = 5 * time.Minute
+	}
+	if cfg.Username != "" {
+		s.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, host)
+	}
+	subject, text := cfg.Subject, cfg.Text
+	if subject == "" {
+		subject = defaultMailSubject
+	}
+	if text == "" {
+		text = defaultMailText
+	}
+	batch := &MailBatch{Clusters: []string{""}, Alerts: []MessageData{NewMessageData(SampleNotification())}}
+	if s.subject, err = template.New("subject").Funcs(messageFuncs).Parse(subject); err == nil {
+		err = s.subject.Execute(ioutil.Discard, batch)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("notifier %q: subject: %s", name, err)
+	}
+	if s.text, err = template.New("text").Funcs(messageFuncs).Parse(text); err == nil {
+		err = s.text.Execute(ioutil.Discard, batch)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("notifier %q: text: %s", name, err)
+	}
+	if cfg.HTML != "" {
+		if s.html, err = htmltemplate.New("html").Funcs(htmltemplate.FuncMap(messageFuncs)).Parse(cfg.HTML); err == nil {
+			err = s.html.Execute(ioutil.Discard, batch)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("notifier %q: html: %s", name, err)
+		}
+	}
+	go func() {
+		for range time.Tick(s.interval) {
+			s.Flush()
+		}
+	}()
+	return s, nil
+}
+
+func (s *SMTPNotifier) Name() string {
+	return s.name
+}
+
+// Notify queues n for the next mail to each of its recipients
+func (s *SMTPNotifier) Notify(n *Notification) error {
+	recipients := s.recipientsOf(n)
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range recipients {
+		batch, ok := s.pending[r]
+		if !ok {
+			batch = &MailBatch{Recipient: r, Since: now}
+			s.pending[r] = batch
+		}
+		batch.Alerts = append(batch.Alerts, NewMessageData(n))
+	}
+	log.WithFields(log.Fields{"notifier": s.name, "recipients": recipients}).Debug("Mail queued")
+	return nil
+}
+
+func (s *SMTPNotifier) recipientsOf(n *Notification) []string {
+	if r, ok := s.recipients[n.Class]; ok {
+		return r
+	}
+	return s.to
+}
+
+// OnAbandon sets where the alerts of batches failing mailMaxAttempts times are reported
+func (s *SMTPNotifier) OnAbandon(report func(n *Notification, attempts int, err error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.abandon = report
+}
+
+// Flush mails every pending batch, batches failing to send are kept for the next flush
+func (s *SMTPNotifier) Flush() {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = map[string]*MailBatch{}
+	abandon := s.abandon
+	s.mu.Unlock()
+
+	for r, batch := range pending {
+		batch.Until = time.Now()
+		if err := s.send(batch); err != nil {
+			batch.attempts++
+			log.WithFields(log.Fields{"notifier": s.name, "recipient": r, "alerts": len(batch.Alerts), "attempts": batch.attempts, "error": err}).Error("Mail failed")
+			metrics.Inc("sentinel_notifications_failed_total", Labels{"notifier": s.name})
+			if batch.attempts < mailMaxAttempts {
+				s.requeue(batch)
+				continue
+			}
+			log.WithFields(log.Fields{"notifier": s.name, "recipient": r, "alerts": len(batch.Alerts), "attempts": batch.attempts}).Error("Mail abandoned")
+			if abandon != nil {
+				for _, a := range batch.Alerts {
+					abandon(a.Notification, batch.attempts, fmt.Errorf("smtp %s: %s", r, err))
+				}
+			}
+			continue
+		}
+		log.WithFields(log.Fields{"notifier": s.name, "recipient": r, "alerts": len(batch.Alerts)}).Info("Mail sent")
+	}
+}
+
+// requeue puts a failed batch back in front of the alerts queued meanwhile
+func (s *SMTPNotifier) requeue(batch *MailBatch) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if queued, ok := s.pending[batch.Recipient]; ok {
+		batch.Alerts = append(batch.Alerts, queued.Alerts...)
+	}
+	s.pending[batch.Recipient] = batch
+}
+
+func (s *SMTPNotifier) send(batch *MailBatch) error {
+	// rebuilt on every attempt, a requeued batch has been sent before
+	batch.Clusters = nil
+	clusters := map[string]bool{}
+	for _, a := range batch.Alerts {
+		if a.Cluster != "" && !clusters[a.Cluster] {
+			clusters[a.Cluster] = true
+			batch.Clusters = append(batch.Clusters, a.Cluster)
+		}
+	}
+	sort.Strings(batch.Clusters)
+	msg, err := s.message(batch)
+	if err != nil {
+		return err
+	}
+
+	c, err := smtp.Dial(s.addr)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	host, _, _ := net.SplitHostPort(s.addr)
+	if s.startTLS {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if s.auth != nil {
+		if err := c.Auth(s.auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(batch.Recipient); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// message renders batch as MIME mail, multipart/alternative when an html template is configured
+func (s *SMTPNotifier) message(batch *MailBatch) ([]byte, error) {
+	var subject, text bytes.Buffer
+	if err := s.subject.Execute(&subject, batch); err != nil {
+		return nil, err
+	}
+	if err := s.text.Execute(&text, batch); err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\n",
+		s.from, batch.Recipient, strings.TrimSpace(subject.String()), time.Now().Format(time.RFC1123Z))
+	if s.html == nil {
+		b.WriteString("Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuotedPrintable(&b, text.Bytes()); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	}
+	var html bytes.Buffer
+	if err := s.html.Execute(&html, batch); err != nil {
+		return nil, err
+	}
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{{"text/plain", text.Bytes()}, {"text/html", html.Bytes()}} {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(pw, part.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mw.Boundary())
+	b.Write(body.Bytes())
+	return b.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, content []byte) error {
+	qw := quotedprintable.NewWriter(w)
+	if _, err := qw.Write(content); err != nil {
+		return err
+	}
+	return qw.Close()
+}
+
+func (s *SMTPNotifier) Describe(n *Notification) (string, []string) {
+	return "smtp://" + s.addr, append([]string{"every " + s.interval.String()}, s.recipientsOf(n)...)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// smtpSink a fake SMTP server keeping the mails it receives, rejecting the next rejects recipients
+type smtpSink struct {
+	listener net.Listener
+	mu       sync.Mutex
+	mails    map[string][]string // data per recipient
+	rejects  int
+}
+
+func newSMTPSink() *smtpSink {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	s := &smtpSink{listener: l, mails: map[string][]string{}}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpSink) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	fmt.Fprint(conn, "220 sink\r\n")
+	var rcpt string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"), strings.HasPrefix(cmd, "MAIL"), strings.HasPrefix(cmd, "RSET"):
+			fmt.Fprint(conn, "250 ok\r\n")
+		case strings.HasPrefix(cmd, "RCPT"):
+			s.mu.Lock()
+			reject := s.rejects > 0
+			if reject {
+				s.rejects--
+			}
+			s.mu.Unlock()
+			if reject {
+				fmt.Fprint(conn, "550 mailbox unavailable\r\n")
+				continue
+			}
+			rcpt = strings.Trim(strings.TrimSpace(line)[len("RCPT TO:"):], "<>")
+			fmt.Fprint(conn, "250 ok\r\n")
+		case cmd == "DATA":
+			fmt.Fprint(conn, "354 go ahead\r\n")
+			var data []string
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data = append(data, l)
+			}
+			s.mu.Lock()
+			s.mails[rcpt] = append(s.mails[rcpt], strings.Join(data, ""))
+			s.mu.Unlock()
+			fmt.Fprint(conn, "250 queued\r\n")
+		case cmd == "QUIT":
+			fmt.Fprint(conn, "221 bye\r\n")
+			return
+		default:
+			fmt.Fprint(conn, "502 unknown\r\n")
+		}
+	}
+}
+
+func (s *smtpSink) received(rcpt string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.mails[rcpt]
+}
+
+var _ = Describe("SMTPNotifier", func() {
+	var (
+		sink *smtpSink
+		cfg  NotifierConfig
+	)
+
+	BeforeEach(func() {
+		sink = newSMTPSink()
+		cfg = NotifierConfig{
+			Addr:       sink.listener.Addr().String(),
+			From:       "sentinel@example.com",
+			To:         []string{"ops@example.com"},
+			Recipients: map[string][]string{ClassOom: {"dev@example.com"}},
+			Interval:   time.Hour,
+		}
+	})
+
+	AfterEach(func() {
+		sink.listener.Close()
+	})
+
+	notification := func(class, cluster string) *Notification {
+		return &Notification{Class: class, Severity: "error", Cluster: cluster, Message: class + " of db", Event: containerEvent("die", "a", "db.1.x", "1", time.Unix(1500000000, 0))}
+	}
+
+	It("needs a default recipient", func() {
+		cfg.To = nil
+		_, err := NewSMTPNotifier("mail", cfg)
+		Expect(err).To(MatchError(ContainSubstring("smtp needs to")))
+	})
+
+	It("rejects classes without recipients", func() {
+		cfg.Recipients[ClassEvent] = nil
+		_, err := NewSMTPNotifier("mail", cfg)
+		Expect(err).To(MatchError(ContainSubstring(`no recipients for class "event"`)))
+	})
+
+	It("mails one batch per recipient on flush", func() {
+		s, err := NewSMTPNotifier("mail", cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.Notify(notification(ClassEvent, "prod"))).To(Succeed())
+		Expect(s.Notify(notification(ClassEvent, "staging"))).To(Succeed())
+		Expect(s.Notify(notification(ClassOom, "prod"))).To(Succeed())
+		s.Flush()
+
+		Expect(sink.received("ops@example.com")).To(HaveLen(1))
+		mail := sink.received("ops@example.com")[0]
+		Expect(mail).To(ContainSubstring("To: ops@example.com"))
+		Expect(mail).To(ContainSubstring("Subject: [sentinel] 2 alert(s) on prod, staging"))
+		Expect(mail).To(ContainSubstring("event of db"))
+		Expect(sink.received("dev@example.com")).To(HaveLen(1))
+		Expect(sink.received("dev@example.com")[0]).To(ContainSubstring("oom of db"))
+	})
+
+	It("keeps failed batches for the next flush, without repeating their clusters", func() {
+		s, err := NewSMTPNotifier("mail", cfg)
+		Expect(err).NotTo(HaveOccurred())
+		sink.rejects = 1
+		Expect(s.Notify(notification(ClassEvent, "prod"))).To(Succeed())
+		s.Flush()
+		Expect(sink.received("ops@example.com")).To(BeEmpty())
+
+		Expect(s.Notify(notification(ClassEvent, "prod"))).To(Succeed())
+		s.Flush()
+		Expect(sink.received("ops@example.com")).To(HaveLen(1))
+		Expect(sink.received("ops@example.com")[0]).To(ContainSubstring("Subject: [sentinel] 2 alert(s) on prod\r\n"))
+	})
+
+	It("reports the alerts of a batch failing mailMaxAttempts flushes as abandoned", func() {
+		s, err := NewSMTPNotifier("mail", cfg)
+		Expect(err).NotTo(HaveOccurred())
+		var abandoned []*Notification
+		s.OnAbandon(func(n *Notification, attempts int, err error) {
+			Expect(attempts).To(Equal(mailMaxAttempts))
+			Expect(err).To(MatchError(ContainSubstring("mailbox unavailable")))
+			abandoned = append(abandoned, n)
+		})
+		sink.rejects = mailMaxAttempts
+		Expect(s.Notify(notification(ClassEvent, "prod"))).To(Succeed())
+		for i := 0; i < mailMaxAttempts-1; i++ {
+			s.Flush()
+		}
+		Expect(abandoned).To(BeEmpty())
+		s.Flush()
+		Expect(abandoned).To(HaveLen(1))
+		Expect(abandoned[0].Message).To(Equal("event of db"))
+
+		s.Flush()
+		Expect(sink.received("ops@example.com")).To(BeEmpty())
+	})
+})
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// StdoutNotifier writes every notification as one JSON line to stdout
+type StdoutNotifier struct {
+	name string
+	mu   sync.Mutex
+	enc  *json.Encoder
+}
+
+func NewStdoutNotifier(name string) *StdoutNotifier {
+	return &StdoutNotifier{name: name, enc: json.NewEncoder(os.Stdout)}
+}
+
+func (s *StdoutNotifier) Name() string {
+	return s.name
+}
+
+func (s *StdoutNotifier) Notify(n *Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(n)
+}
+
+func (s *StdoutNotifier) Describe(n *Notification) (string, []string) {
+	return "stdout", nil
+}
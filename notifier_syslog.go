@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// syslogSDID structured data id of sentinel's fields, 32473 is the enterprise number reserved for documentation
+const syslogSDID = "sentinel@32473"
+
+// syslogFacilities by name, see RFC 5424 section 6.2.1
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// syslogTimestamp RFC 5424 TIMESTAMP, which allows at most 6 digits of fractional seconds
+const syslogTimestamp = "2006-01-02T15:04:05.000000Z07:00"
+
+// syslogSeverities syslog level per rule severity
+var syslogSeverities = map[string]int{
+	"critical": 2,
+	"error":    3,
+	"warning":  4,
+	"info":     6,
+}
+
+// SyslogNotifier writes notifications as RFC 5424 messages to a syslog receiver over udp, tcp or tls.
+// Stream transports use octet-counting framing (RFC 6587). With events set every Docker event
+// matched by a rule is forwarded as well, with msgid "event" and the event JSON as message.
+type SyslogNotifier struct {
+	name     string
+	network  string
+	addr     string
+	facility int
+	appName  string
+	hostname string
+	events   bool
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func NewSyslogNotifier(name string, cfg NotifierConfig) (*SyslogNotifier, error) {
+	network := cfg.Network
+	if network == "" {
+		network = "udp"
+	}
+	if network != "udp" && network != "tcp" && network != "tls" {
+		return nil, fmt.Errorf("notifier %q: unknown syslog network %q", name, network)
+	}
+	if cfg.Addr == "" {
+		return nil, fmt.Errorf("notifier %q: syslog without addr", name)
+	}
+	facility := cfg.Facility
+	if facility == "" {
+		facility = "daemon"
+	}
+	f, ok := syslogFacilities[facility]
+	if !ok {
+		return nil, fmt.Errorf("notifier %q: unknown syslog facility %q", name, facility)
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "-"
+	}
+	return &SyslogNotifier{name: name, network: network, addr: cfg.Addr, facility: f, appName: "sentinel", hostname: hostname, events: cfg.Events}, nil
+}
+
+func (s *SyslogNotifier) Name() string {
+	return s.name
+}
+
+func (s *SyslogNotifier) Notify(n *Notification) error {
+	alert := NewAlert(n)
+	severity, ok := syslogSeverities[alert.Severity]
+	if !ok {
+		severity = syslogSeverities["error"]
+	}
+	return s.write(s.format(severity, alert.Class, structuredData(alert), alert.Message))
+}
+
+// ForwardsEvents reports whether matched events are forwarded
+func (s *SyslogNotifier) ForwardsEvents() bool {
+	return s.events
+}
+
+// Forward writes the matched event m of cluster
+func (s *SyslogNotifier) Forward(cluster string, m Event) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	alert := NewAlert(&Notification{Cluster: cluster, Event: m})
+	return s.write(s.format(syslogSeverities["info"], "event", structuredData(alert), string(data)))
+}
+
+// format renders one RFC 5424 message
+func (s *SyslogNotifier) format(severity int, msgid, sd, msg string) string {
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s %s %s",
+		s.facility*8+severity, time.Now().UTC().Format(syslogTimestamp), s.hostname, s.appName, os.Getpid(), msgid, sd, msg)
+}
+
+// structuredData renders the cluster, service, node and image of alert as SD-ELEMENT
+func structuredData(alert *Alert) string {
+	params := []struct{ name, value string }{
+		{"cluster", alert.Cluster},
+		{"service", alert.Service},
+		{"node", alert.Node},
+		{"image", alert.Image},
+		{"rule", alert.Rule},
+		{"status", alert.Status},
+		{"exitCode", alert.ExitCode},
+	}
+	sd := "[" + syslogSDID
+	for _, p := range params {
+		if p.value != "" {
+			sd += " " + p.name + `="` + sdEscaper.Replace(p.value) + `"`
+		}
+	}
+	return sd + "]"
+}
+
+// sdEscaper escapes PARAM-VALUE as required by RFC 5424 section 6.3.3
+var sdEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// write sends msg, dialing on first use and after a failed write
+func (s *SyslogNotifier) write(msg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		conn, err := s.dial()
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	if s.network != "udp" {
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := s.conn.Write([]byte(msg)); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return fmt.Errorf("syslog %s://%s: %s", s.network, s.addr, err)
+	}
+	return nil
+}
+
+func (s *SyslogNotifier) dial() (net.Conn, error) {
+	log.WithFields(log.Fields{"notifier": s.name, "network": s.network, "addr": s.addr}).Info("Connecting to syslog")
+	if s.network == "tls" {
+		return tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", s.addr, nil)
+	}
+	return net.DialTimeout(s.network, s.addr, 10*time.Second)
+}
+
+func (s *SyslogNotifier) Describe(n *Notification) (string, []string) {
+	alert := NewAlert(n)
+	return s.network + "://" + s.addr, []string{fmt.Sprintf("severity=%d", syslogSeverities[alert.Severity]), structuredData(alert)}
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SyslogNotifier", func() {
+	It("formats RFC 5424 headers with at most microsecond timestamps", func() {
+		s, err := NewSyslogNotifier("syslog", NotifierConfig{Addr: "127.0.0.1:514", Facility: "local0"})
+		Expect(err).NotTo(HaveOccurred())
+		msg := s.format(syslogSeverities["error"], ClassOom, "-", "db ran out of memory")
+		Expect(msg).To(MatchRegexp(`^<131>1 \d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{6}Z \S+ sentinel \d+ oom - db ran out of memory$`))
+	})
+})
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Headers set on every webhook request when a secret is configured.
+// The signature is the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the secret,
+// receivers should reject requests whose timestamp is too old to prevent replay.
+const (
+	WebhookTimestampHeader = "X-Sentinel-Timestamp"
+	WebhookSignatureHeader = "X-Sentinel-Signature"
+)
+
+// WebhookTarget one URL alerts are POSTed to, unset settings default to the notifier's
+type WebhookTarget struct {
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	Timeout time.Duration     `yaml:"timeout"`
+}
+
+// WebhookNotifier POSTs notifications as Alert JSON to one or more URLs.
+// Each URL is a target of its own for the dispatcher, requests failing with a 5xx, 408, 429 or a network
+// error are retried through the outbox, other responses are undeliverable right away.
+type WebhookNotifier struct {
+	name    string
+	targets []webhookTarget
+	secret  []byte
+}
+
+type webhookTarget struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func NewWebhookNotifier(name string, cfg NotifierConfig) (*WebhookNotifier, error) {
+	targets := cfg.Targets
+	if cfg.URL != "" {
+		targets = append([]WebhookTarget{{URL: cfg.URL}}, targets...)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("notifier %q: webhook without url", name)
+	}
+	w := &WebhookNotifier{name: name, secret: []byte(cfg.Secret)}
+	for _, t := range targets {
+		timeout := t.Timeout
+		if timeout == 0 {
+			timeout = cfg.Timeout
+		}
+		if timeout == 0 {
+			timeout = 10 * time.Second
+		}
+		headers := map[string]string{}
+		for k, v := range cfg.Headers {
+			headers[k] = v
+		}
+		for k, v := range t.Headers {
+			headers[k] = v
+		}
+		w.targets = append(w.targets, webhookTarget{url: t.URL, headers: headers, client: &http.Client{Timeout: timeout}})
+	}
+	return w, nil
+}
+
+func (w *WebhookNotifier) Name() string {
+	return w.name
+}
+
+// Notify POSTs n to all targets, failing if any target could not be delivered,
+// for good only if all failed targets failed for good
+func (w *WebhookNotifier) Notify(n *Notification) error {
+	var failed []string
+	permanent := true
+	for _, t := range w.targets {
+		if err := w.NotifyTarget(t.url, n); err != nil {
+			failed = append(failed, err.Error())
+			if _, ok := err.(PermanentError); !ok {
+				permanent = false
+			}
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	err := fmt.Errorf("%s", strings.Join(failed, "; "))
+	if permanent {
+		return PermanentError{err}
+	}
+	return err
+}
+
+// Targets the URLs notifications are POSTed to
+func (w *WebhookNotifier) Targets() []string {
+	urls := make([]string, 0, len(w.targets))
+	for _, t := range w.targets {
+		urls = append(urls, t.url)
+	}
+	return urls
+}
+
+// NotifyTarget POSTs n to the target with url
+func (w *WebhookNotifier) NotifyTarget(url string, n *Notification) error {
+	for _, t := range w.targets {
+		if t.url == url {
+			body, err := json.Marshal(NewAlert(n))
+			if err != nil {
+				return err
+			}
+			return w.post(t, body)
+		}
+	}
+	return fmt.Errorf("webhook: unknown target %s", url)
+}
+
+func (w *WebhookNotifier) post(t webhookTarget, body []byte) error {
+	req, err := http.NewRequest("POST", t.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	if len(w.secret) > 0 {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(WebhookTimestampHeader, timestamp)
+		req.Header.Set(WebhookSignatureHeader, "sha256="+w.sign(timestamp, body))
+	}
+	res, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook %s: %s", t.url, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		err := fmt.Errorf("webhook %s: %s", t.url, res.Status)
+		if res.StatusCode < 500 && res.StatusCode != http.StatusRequestTimeout && res.StatusCode != http.StatusTooManyRequests {
+			return PermanentError{err}
+		}
+		return err
+	}
+	log.WithFields(log.Fields{"notifier": w.name, "url": t.url, "status": res.StatusCode}).Info("Webhook delivered")
+	return nil
+}
+
+// sign the hex HMAC-SHA256 of "<timestamp>.<body>"
+func (w *WebhookNotifier) sign(timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, w.secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (w *WebhookNotifier) Describe(n *Notification) (string, []string) {
+	args := []string{"POST"}
+	if len(w.secret) > 0 {
+		args = append(args, WebhookSignatureHeader+": sha256=…")
+	}
+	for k, v := range w.targets[0].headers {
+		args = append(args, k+": "+v)
+	}
+	return strings.Join(w.Targets(), ","), args
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WebhookNotifier", func() {
+	var (
+		ok, failing, rejecting *httptest.Server
+		requests               map[string][]*http.Request
+		bodies                 map[string][][]byte
+		failures               int
+	)
+
+	record := func(name string, status func() int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := ioutil.ReadAll(r.Body)
+			Expect(err).NotTo(HaveOccurred())
+			requests[name] = append(requests[name], r)
+			bodies[name] = append(bodies[name], body)
+			w.WriteHeader(status())
+		}))
+	}
+
+	BeforeEach(func() {
+		requests = map[string][]*http.Request{}
+		bodies = map[string][][]byte{}
+		failures = 1
+		ok = record("ok", func() int { return http.StatusOK })
+		failing = record("failing", func() int {
+			if failures > 0 {
+				failures--
+				return http.StatusServiceUnavailable
+			}
+			return http.StatusOK
+		})
+		rejecting = record("rejecting", func() int { return http.StatusNotFound })
+	})
+
+	AfterEach(func() {
+		ok.Close()
+		failing.Close()
+		rejecting.Close()
+	})
+
+	notification := func() *Notification {
+		return &Notification{Class: ClassOom, Severity: "critical", Cluster: "prod", Message: "oom", Event: containerEvent("oom", "a", "db.1.x", "137", time.Unix(1500000000, 0))}
+	}
+
+	It("posts the alert signed, with the configured headers", func() {
+		w, err := NewWebhookNotifier("hook", NotifierConfig{
+			URL:     ok.URL,
+			Secret:  "s3cret",
+			Headers: map[string]string{"X-Team": "ops"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.Notify(notification())).To(Succeed())
+
+		Expect(requests["ok"]).To(HaveLen(1))
+		r, body := requests["ok"][0], bodies["ok"][0]
+		Expect(r.Method).To(Equal("POST"))
+		Expect(r.Header.Get("Content-Type")).To(Equal("application/json"))
+		Expect(r.Header.Get("X-Team")).To(Equal("ops"))
+		timestamp := r.Header.Get(WebhookTimestampHeader)
+		Expect(timestamp).NotTo(BeEmpty())
+		Expect(r.Header.Get(WebhookSignatureHeader)).To(Equal("sha256=" + w.sign(timestamp, body)))
+
+		var alert Alert
+		Expect(json.Unmarshal(body, &alert)).To(Succeed())
+		Expect(alert.Class).To(Equal(ClassOom))
+		Expect(alert.Service).To(Equal("db"))
+	})
+
+	It("fails on server errors without retrying inline", func() {
+		w, err := NewWebhookNotifier("hook", NotifierConfig{URL: failing.URL})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.Notify(notification())).To(MatchError(ContainSubstring("503")))
+		Expect(requests["failing"]).To(HaveLen(1))
+	})
+
+	It("fails on client errors for good", func() {
+		w, err := NewWebhookNotifier("hook", NotifierConfig{URL: rejecting.URL})
+		Expect(err).NotTo(HaveOccurred())
+		err = w.Notify(notification())
+		Expect(err).To(MatchError(ContainSubstring("404")))
+		Expect(err).To(BeAssignableToTypeOf(PermanentError{}))
+	})
+
+	It("reports client errors as undeliverable instead of retrying them", func() {
+		d, err := NewDispatcher(&Config{
+			Notifiers: map[string]NotifierConfig{
+				"hook": {Type: "webhook", URL: rejecting.URL},
+				"ops":  {Type: "webhook", URL: ok.URL},
+			},
+			Routes: map[string][]string{ClassOom: {"hook"}, ClassUndeliverable: {"ops"}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(d.Dispatch(notification())).To(Succeed())
+		Expect(requests["rejecting"]).To(HaveLen(1))
+		Expect(d.retry.Len()).To(Equal(0))
+
+		Expect(bodies["ok"]).To(HaveLen(1))
+		var alert Alert
+		Expect(json.Unmarshal(bodies["ok"][0], &alert)).To(Succeed())
+		Expect(alert.Class).To(Equal(ClassUndeliverable))
+	})
+
+	It("retries only the targets that failed", func() {
+		d, err := NewDispatcher(&Config{
+			Notifiers: map[string]NotifierConfig{"hook": {Type: "webhook", Targets: []WebhookTarget{{URL: ok.URL}, {URL: failing.URL}}}},
+			Routes:    map[string][]string{ClassOom: {"hook"}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(d.Dispatch(notification())).To(Succeed())
+		Expect(requests["ok"]).To(HaveLen(1))
+		Expect(requests["failing"]).To(HaveLen(1))
+
+		due := d.retry.Due(time.Now().Add(time.Hour))
+		Expect(due).To(HaveLen(1))
+		Expect(due[0].Target).To(Equal(failing.URL))
+		d.redeliver(due[0])
+		Expect(requests["ok"]).To(HaveLen(1))
+		Expect(requests["failing"]).To(HaveLen(2))
+		Expect(d.retry.Len()).To(Equal(0))
+	})
+})
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	. "github.com/larskluge/babl-server/utils"
+	bn "github.com/larskluge/babl/bablnaming"
+)
+
+// Pipeline turns decoded Docker events into notifications
+type Pipeline struct {
+	Cluster    string
+	Endpoint   string
+	Rules      []*Rule
+	Dispatcher *Dispatcher
+	Flapping   *FlapTracker
+	Grouping   *Grouper
+	Incidents  *IncidentTracker
+	Exits      *ExitClassifier
+	State      *SwarmState
+	Clock      *EventClock
+
+	hk               sync.Mutex
+	nextHousekeeping time.Time
+}
+
+// housekeepingInterval how often, in event time, flapping services recover, incidents resolve and state expires
+const housekeepingInterval = 10 * time.Second
+
+// NewPipeline wires rules to the dispatcher, actions without a route are reported
+func NewPipeline(cluster ClusterConfig, cfg *Config, rules []*Rule, dispatcher *Dispatcher) *Pipeline {
+	for _, rule := range rules {
+		for _, action := range rule.Actions {
+			if !dispatcher.Routes(action) {
+				log.WithFields(log.Fields{"rule": rule.Name, "action": action}).Warn("No notifiers routed for action")
+			}
+		}
+	}
+	p := &Pipeline{Cluster: cluster.Name, Endpoint: cluster.Endpoint, Rules: rules, Dispatcher: dispatcher, Exits: NewExitClassifier(), State: NewSwarmState(cluster.Name), Incidents: NewIncidentTracker(cfg.Incidents), Clock: &EventClock{}}
+	if cfg.Flapping.Threshold > 0 {
+		p.Flapping = NewFlapTracker(cfg.Flapping)
+	}
+	if len(cfg.Grouping.Classes) > 0 {
+		g, err := NewGrouper(cfg.Grouping)
+		Check(err)
+		g.Firing = p.firing
+		p.Grouping = g
+	}
+	return p
+}
+
+// Start runs the periodic housekeeping of the pipeline, e.g. recovery of flapping services and digests.
+// Housekeeping also runs while handling events, whenever their time passes the next housekeeping.
+func (p *Pipeline) Start() {
+	go func() {
+		for range time.Tick(time.Second) {
+			p.housekeep(p.Clock.Now())
+		}
+	}()
+}
+
+// housekeep dispatches the digests due at now, and recovers flapping services, resolves incidents
+// and expires state once housekeeping is due
+func (p *Pipeline) housekeep(now time.Time) {
+	p.hk.Lock()
+	defer p.hk.Unlock()
+	p.flushDigests(now)
+	if now.Before(p.nextHousekeeping) {
+		return
+	}
+	p.nextHousekeeping = now.Add(housekeepingInterval)
+	for _, n := range p.Flapping.Expire(p.Cluster, now) {
+		p.sendLogged(n)
+	}
+	for _, n := range p.Incidents.Resolve(p.Cluster, now, p.State) {
+		p.sendLogged(n)
+	}
+	p.State.Expire(now)
+}
+
+// flushDigests dispatches the digests due at now,
+// the members of a digest that could not be dispatched are flushed again with the next digest
+func (p *Pipeline) flushDigests(now time.Time) {
+	for _, d := range p.Grouping.Flush(now) {
+		if err := p.Dispatcher.Dispatch(d); err != nil {
+			log.WithFields(log.Fields{"group": d.Group, "error": err}).Error("Digest not dispatched, keeping it")
+			p.Grouping.Requeue(d, now)
+		}
+	}
+}
+
+// Drain dispatches all digests still waiting in the grouping stage, e.g. once a replay ended
+func (p *Pipeline) Drain() {
+	for _, n := range p.Grouping.FlushAll(p.Clock.Now()) {
+		if err := p.Dispatcher.Dispatch(n); err != nil {
+			log.WithFields(log.Fields{"group": n.Group, "error": err}).Error("Digest lost on shutdown")
+		}
+	}
+}
+
+// sendLogged sends a notification not caused by an event, which cannot be redelivered by its source
+func (p *Pipeline) sendLogged(n *Notification) {
+	if err := p.send(n); err != nil {
+		log.WithFields(log.Fields{"class": n.Class, "error": err}).Error("Notification lost")
+	}
+}
+
+// send hands n to the grouping stage, or straight to the dispatcher if its class is not grouped
+func (p *Pipeline) send(n *Notification) error {
+	if n.Endpoint == "" {
+		n.Endpoint = p.Endpoint
+	}
+	if p.Grouping.Add(n, p.Clock.Now()) {
+		return nil
+	}
+	return p.Dispatcher.Dispatch(n)
+}
+
+// Handle runs the actions of every rule matching m, plain event notifications of flapping services are suppressed
+func (p *Pipeline) Handle(m Event) error {
+	if m.TimeNano > 0 || m.Time > 0 {
+		p.Clock.Advance(eventTime(m))
+	}
+	p.housekeep(p.Clock.Now())
+	p.Exits.Classify(&m)
+	p.State.Observe(m)
+	if m.Status == "die" || m.Status == "oom" {
+		m.Uptime = p.State.Uptime(m)
+	}
+	if m.Type == "node" {
+		node := DecodeNodeEvent(m)
+		log.WithFields(log.Fields{"node": node.ID, "name": node.Name, "state": node.State, "availability": node.Availability, "role": node.Role, "role_old": node.RoleOld}).Info("Node Event")
+	}
+	if incident := p.Incidents.Observe(p.Cluster, m); incident != nil {
+		if err := p.send(incident); err != nil {
+			return err
+		}
+	}
+	flap, flapping := p.Flapping.Observe(p.Cluster, m)
+	if flap != nil {
+		if err := p.send(flap); err != nil {
+			return err
+		}
+	}
+	matched := false
+	for _, rule := range p.Rules {
+		if !rule.Matches(&m) {
+			continue
+		}
+		if !matched {
+			p.Dispatcher.Forward(p.Cluster, m)
+			matched = true
+		}
+		severity := rule.SeverityOf(&m)
+		log.WithFields(log.Fields{"rule": rule.Name, "severity": severity, "status": m.Status, "exit": m.ExitClass, "id": m.ID}).Debug("Rule matched")
+		for _, action := range rule.Actions {
+			if flapping && action == ClassEvent {
+				log.WithFields(log.Fields{"rule": rule.Name, "service": m.Actor.Attributes.ComDockerSwarmServiceName, "status": m.Status}).Debug("Suppressed, service is flapping")
+				continue
+			}
+			n := p.notification(action, m)
+			n.Rule = rule.Name
+			n.Severity = severity
+			if rule.template != nil {
+				if msg, err := RenderMessage(rule.template, n); err != nil {
+					log.WithFields(log.Fields{"rule": rule.Name, "error": err}).Warn("Message template failed, keeping default message")
+				} else {
+					n.Message = msg
+				}
+			}
+			if err := p.send(n); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// firing reports whether the service of n is still broken, digests of its group are repeated meanwhile
+func (p *Pipeline) firing(n *Notification) bool {
+	service := n.Event.Actor.Attributes.ComDockerSwarmServiceName
+	return service != "" && p.State.Broken(service)
+}
+
+func (p *Pipeline) notification(class string, m Event) *Notification {
+	switch {
+	case class == ClassOom:
+		return p.oomNotification(m)
+	case m.Type == "node":
+		return p.nodeNotification(class, m)
+	}
+	return p.eventNotification(class, m)
+}
+
+func (p *Pipeline) eventNotification(class string, m Event) *Notification {
+	log.WithFields(log.Fields{"cluster": p.Cluster, "instance": m.Actor.Attributes.ComDockerSwarmTaskName, "status": m.Status, "exit": m.ExitClass, "id": m.ID, "from": m.From}).Info("Docker Event")
+	name := m.Actor.Attributes.ComDockerSwarmTaskName
+	if name == "" {
+		name = m.From
+	}
+	str := fmt.Sprintf("[%s] %s --> %s", p.Cluster, name, m.Status)
+	if m.Status == "die" && m.Actor.Attributes.ExitCode != "" {
+		str += fmt.Sprintf(" (exit %s, %s)", m.Actor.Attributes.ExitCode, m.ExitClass)
+	}
+	return &Notification{Class: class, Cluster: p.Cluster, Message: str, Event: m}
+}
+
+func (p *Pipeline) oomNotification(m Event) *Notification {
+	module := bn.ServiceToModule(m.Actor.Attributes.ComDockerSwarmServiceName)
+	log.WithFields(log.Fields{"module": module, "instance": m.ID}).Info("oom-restart")
+	str := fmt.Sprintf("[%s] %s instance %s --> oom", p.Cluster, module, m.ID)
+	return &Notification{Class: ClassOom, Cluster: p.Cluster, Message: str, Event: m}
+}
+
+func (p *Pipeline) nodeNotification(class string, m Event) *Notification {
+	node := DecodeNodeEvent(m)
+	name := node.Name
+	if name == "" {
+		name = node.ID
+	}
+	var changes []string
+	if node.State != "" {
+		changes = append(changes, "state "+node.StateOld+" -> "+node.State)
+	}
+	if node.Availability != "" {
+		changes = append(changes, "availability "+node.AvailabilityOld+" -> "+node.Availability)
+	}
+	if node.Role != "" {
+		changes = append(changes, "role "+node.RoleOld+" -> "+node.Role)
+	}
+	services := p.State.ServicesOnNode(node.ID)
+	str := fmt.Sprintf("[%s] node %s --> %s", p.Cluster, name, strings.Join(changes, ", "))
+	if len(services) > 0 {
+		str += "; running: " + strings.Join(services, ", ")
+	}
+	return &Notification{Class: class, Cluster: p.Cluster, Message: str, Services: services, Event: m}
+}
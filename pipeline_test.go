@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Pipeline", func() {
+	var (
+		p        *Pipeline
+		recorder *Recorder
+	)
+
+	BeforeEach(func() {
+		cfg := &Config{
+			Notifiers: map[string]NotifierConfig{"out": {Type: "stdout"}},
+			Routes:    map[string][]string{ClassEvent: {"out"}},
+			Grouping:  GroupingConfig{Classes: []string{ClassEvent}, GroupBy: []string{"service"}, GroupWait: 30 * time.Second, GroupInterval: 5 * time.Minute},
+		}
+		d, err := NewDispatcher(cfg)
+		Expect(err).NotTo(HaveOccurred())
+		recorder = NewRecorder(100)
+		d.Recorder = recorder
+		p = NewPipeline(ClusterConfig{Name: "prod"}, cfg, LoadRules(""), d)
+	})
+
+	It("flushes digests by event time, so a replay behaves like live", func() {
+		night := time.Unix(1500000000, 0)
+		for hour := 0; hour < 8; hour++ {
+			at := night.Add(time.Duration(hour) * time.Hour)
+			Expect(p.Handle(containerEvent("die", fmt.Sprint(hour), "db.1.x", "1", at))).To(Succeed())
+			Expect(p.Handle(containerEvent("start", fmt.Sprint(hour)+"b", "db.1.y", "", at.Add(10*time.Second)))).To(Succeed())
+		}
+		Expect(recorder.Recordings()).To(HaveLen(7))
+		for _, r := range recorder.Recordings() {
+			Expect(r.Notification.Members).To(HaveLen(2))
+		}
+		p.Drain()
+		Expect(recorder.Recordings()).To(HaveLen(8))
+	})
+})
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Describer is implemented by notifiers able to tell where and how they would deliver n
+type Describer interface {
+	Describe(n *Notification) (target string, args []string)
+}
+
+// Recording a notification captured instead of being delivered
+type Recording struct {
+	Time         time.Time     `json:"time"`
+	Notifier     string        `json:"notifier"`
+	Target       string        `json:"target"`
+	Args         []string      `json:"args,omitempty"`
+	Notification *Notification `json:"notification"`
+}
+
+// Recorder keeps the last recordings of a dry run
+type Recorder struct {
+	mu         sync.Mutex
+	keep       int
+	recordings []Recording
+}
+
+func NewRecorder(keep int) *Recorder {
+	if keep <= 0 {
+		keep = 100
+	}
+	return &Recorder{keep: keep}
+}
+
+// Record logs what notifier would have delivered and remembers it
+func (r *Recorder) Record(notifier Notifier, n *Notification) {
+	rec := Recording{Time: time.Now(), Notifier: notifier.Name(), Target: notifier.Name(), Notification: n}
+	if d, ok := notifier.(Describer); ok {
+		rec.Target, rec.Args = d.Describe(n)
+	}
+	log.WithFields(log.Fields{"notifier": rec.Notifier, "target": rec.Target, "args": rec.Args, "class": n.Class, "severity": n.Severity, "message": n.Message}).Info("Dry run: notification recorded")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recordings = append(r.recordings, rec)
+	if len(r.recordings) > r.keep {
+		r.recordings = r.recordings[len(r.recordings)-r.keep:]
+	}
+}
+
+// Recordings the last recordings, oldest first
+func (r *Recorder) Recordings() []Recording {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Recording{}, r.recordings...)
+}
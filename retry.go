@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// RetryConfig backoff of failed deliveries, Dir keeps the outbox across restarts
+type RetryConfig struct {
+	Dir            string        `yaml:"dir"`
+	MaxAttempts    int           `yaml:"max_attempts"`
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+}
+
+// Delivery a notification still to be delivered by one notifier
+type Delivery struct {
+	ID           string        `json:"id"`
+	Notifier     string        `json:"notifier"`
+	Target       string        `json:"target,omitempty"` // of a TargetNotifier, only the failed target is retried
+	Notification *Notification `json:"notification"`
+	Attempts     int           `json:"attempts"`
+	NextAttempt  time.Time     `json:"next_attempt"`
+	LastError    string        `json:"last_error"`
+}
+
+// RetryQueue outbox of failed deliveries, retried with exponential backoff
+type RetryQueue struct {
+	cfg        RetryConfig
+	mu         sync.Mutex
+	deliveries map[string]*Delivery
+	seq        int
+}
+
+func NewRetryQueue(cfg RetryConfig) (*RetryQueue, error) {
+	if cfg.MaxAttempts == 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.InitialBackoff == 0 {
+		cfg.InitialBackoff = 5 * time.Second
+	}
+	if cfg.MaxBackoff == 0 {
+		cfg.MaxBackoff = 10 * time.Minute
+	}
+	q := &RetryQueue{cfg: cfg, deliveries: map[string]*Delivery{}}
+	if cfg.Dir == "" {
+		log.Warn("Retry outbox not persisted, configure retry.dir to keep failed deliveries across restarts")
+		return q, nil
+	}
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, err
+	}
+	return q, q.load()
+}
+
+// load reads all deliveries left in the outbox by a previous run
+func (q *RetryQueue) load() error {
+	files, err := filepath.Glob(filepath.Join(q.cfg.Dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		var d Delivery
+		if err := json.Unmarshal(data, &d); err != nil {
+			log.WithFields(log.Fields{"file": file, "error": err}).Warn("Retry outbox: skipping unreadable delivery")
+			continue
+		}
+		q.deliveries[d.ID] = &d
+	}
+	if len(files) > 0 {
+		log.WithFields(log.Fields{"dir": q.cfg.Dir, "deliveries": len(q.deliveries)}).Info("Retry outbox loaded")
+	}
+	return nil
+}
+
+// Enqueue records a first failed attempt of notifier to deliver n, to target if not empty
+func (q *RetryQueue) Enqueue(notifier, target string, n *Notification, err error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.seq++
+	d := &Delivery{
+		ID:           fmt.Sprintf("%d-%d-%s", time.Now().UnixNano(), q.seq, notifier),
+		Notifier:     notifier,
+		Target:       target,
+		Notification: n,
+	}
+	q.failed(d, err)
+	q.deliveries[d.ID] = d
+	return q.persist(d)
+}
+
+// Due removes and returns all deliveries whose next attempt is before now
+func (q *RetryQueue) Due(now time.Time) []*Delivery {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var due []*Delivery
+	for id, d := range q.deliveries {
+		if !d.NextAttempt.After(now) {
+			due = append(due, d)
+			delete(q.deliveries, id)
+		}
+	}
+	return due
+}
+
+// Len number of deliveries waiting for their next attempt
+func (q *RetryQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.deliveries)
+}
+
+// Done removes a delivered or abandoned delivery from the outbox
+func (q *RetryQueue) Done(d *Delivery) {
+	if q.cfg.Dir == "" {
+		return
+	}
+	if err := os.Remove(q.path(d)); err != nil && !os.IsNotExist(err) {
+		log.WithFields(log.Fields{"delivery": d.ID, "error": err}).Warn("Retry outbox: remove failed")
+	}
+}
+
+// Retry reschedules d after another failed attempt, false is returned once its attempts are exhausted
+func (q *RetryQueue) Retry(d *Delivery, err error) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.failed(d, err)
+	if d.Attempts >= q.cfg.MaxAttempts {
+		return false
+	}
+	q.deliveries[d.ID] = d
+	if err := q.persist(d); err != nil {
+		log.WithFields(log.Fields{"delivery": d.ID, "error": err}).Warn("Retry outbox: persist failed")
+	}
+	return true
+}
+
+func (q *RetryQueue) failed(d *Delivery, err error) {
+	d.Attempts++
+	d.LastError = err.Error()
+	backoff := q.cfg.InitialBackoff << uint(d.Attempts-1)
+	if backoff > q.cfg.MaxBackoff || backoff <= 0 {
+		backoff = q.cfg.MaxBackoff
+	}
+	d.NextAttempt = time.Now().Add(backoff)
+	log.WithFields(log.Fields{"delivery": d.ID, "notifier": d.Notifier, "attempts": d.Attempts, "next_attempt": d.NextAttempt, "error": d.LastError}).Warn("Delivery failed")
+}
+
+// persist writes d atomically into the outbox
+func (q *RetryQueue) persist(d *Delivery) error {
+	if q.cfg.Dir == "" {
+		return nil
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	tmp := q.path(d) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, q.path(d))
+}
+
+func (q *RetryQueue) path(d *Delivery) string {
+	return filepath.Join(q.cfg.Dir, strings.Replace(d.ID, string(filepath.Separator), "_", -1)+".json")
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RetryQueue", func() {
+	var (
+		dir string
+		cfg RetryConfig
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "sentinel-retry")
+		Expect(err).NotTo(HaveOccurred())
+		cfg = RetryConfig{Dir: dir, MaxAttempts: 3, InitialBackoff: time.Second, MaxBackoff: 3 * time.Second}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("keeps failed deliveries across restarts", func() {
+		q, err := NewRetryQueue(cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(q.Enqueue("hook", "", &Notification{Class: ClassOom, Message: "oom"}, fmt.Errorf("503"))).To(Succeed())
+		files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+		Expect(files).To(HaveLen(1))
+
+		restarted, err := NewRetryQueue(cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(restarted.Len()).To(Equal(1))
+		Expect(restarted.Due(time.Now())).To(BeEmpty())
+		due := restarted.Due(time.Now().Add(time.Second))
+		Expect(due).To(HaveLen(1))
+		Expect(due[0].Notifier).To(Equal("hook"))
+		Expect(due[0].Notification.Message).To(Equal("oom"))
+		Expect(due[0].LastError).To(Equal("503"))
+
+		restarted.Done(due[0])
+		files, _ = filepath.Glob(filepath.Join(dir, "*.json"))
+		Expect(files).To(BeEmpty())
+	})
+
+	It("backs off exponentially up to MaxBackoff and gives up after MaxAttempts", func() {
+		q, err := NewRetryQueue(cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(q.Enqueue("hook", "", &Notification{}, fmt.Errorf("503"))).To(Succeed())
+		d := q.Due(time.Now().Add(time.Hour))[0]
+
+		Expect(q.Retry(d, fmt.Errorf("503"))).To(BeTrue())
+		Expect(d.NextAttempt).To(BeTemporally("~", time.Now().Add(2*time.Second), 500*time.Millisecond))
+		q.Due(time.Now().Add(time.Hour))
+		Expect(q.Retry(d, fmt.Errorf("503"))).To(BeFalse())
+		Expect(d.Attempts).To(Equal(3))
+	})
+})
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"text/template"
+
+	log "github.com/Sirupsen/logrus"
+	. "github.com/larskluge/babl-server/utils"
+	"gopkg.in/yaml.v2"
+)
+
+// Severities a rule can be tagged with, ordered from least to most severe
+var Severities = []string{"info", "warning", "error", "critical"}
+
+// Rule selects Docker events and names the actions (notification classes) they trigger.
+// Every matcher is a regular expression, empty matchers match anything.
+type Rule struct {
+	Name     string    `yaml:"name"`
+	Match    RuleMatch `yaml:"match"`
+	Actions  []string  `yaml:"actions"`
+	Severity string    `yaml:"severity"`
+
+	// ExitSeverity overrides Severity per exit class, e.g. {clean: info, oom: critical}
+	ExitSeverity map[string]string `yaml:"exit_severity"`
+
+	// Template text/template of the message of the notifications of this rule, see MessageData
+	Template string `yaml:"template"`
+	template *template.Template
+}
+
+// RuleMatch patterns matched against the fields of an Event
+type RuleMatch struct {
+	Type       string            `yaml:"type"`
+	Status     string            `yaml:"status"`
+	Action     string            `yaml:"action"`
+	Image      string            `yaml:"image"`
+	Service    string            `yaml:"service"`
+	Node       string            `yaml:"node"`
+	ExitCode   string            `yaml:"exit_code"`
+	ExitClass  string            `yaml:"exit_class"` // clean, error, sigkill, sigterm or oom
+	Attributes map[string]string `yaml:"attributes"`
+
+	matchers []fieldMatcher
+}
+
+type fieldMatcher struct {
+	re    *regexp.Regexp
+	value eventField
+}
+
+// eventField extracts the string a matcher is applied to
+type eventField func(m *Event) string
+
+// DefaultRules mirror the events sentinel alerted on before rules were configurable
+func DefaultRules() []*Rule {
+	return []*Rule{
+		{Name: "container-events", Match: RuleMatch{Type: "^container$", Status: "die$|start$|oom$"}, Actions: []string{ClassEvent}, Severity: "warning",
+			ExitSeverity: map[string]string{ExitClean: "info", ExitOom: "critical"}},
+		{Name: "container-oom", Match: RuleMatch{Type: "^container$", Status: "^oom$"}, Actions: []string{ClassOom}, Severity: "critical"},
+		{Name: "node-down", Match: RuleMatch{Type: "^node$", Attributes: map[string]string{"state.new": "^down$"}}, Actions: []string{ClassNode}, Severity: "critical"},
+		{Name: "node-drain", Match: RuleMatch{Type: "^node$", Attributes: map[string]string{"availability.new": "^drain$"}}, Actions: []string{ClassNode}, Severity: "warning"},
+	}
+}
+
+// LoadRules reads the YAML rules file at path, an empty path yields DefaultRules
+func LoadRules(path string) []*Rule {
+	rules := DefaultRules()
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		Check(err)
+		var file struct {
+			Rules []*Rule `yaml:"rules"`
+		}
+		err = yaml.Unmarshal(data, &file)
+		Check(err)
+		rules = file.Rules
+		log.WithFields(log.Fields{"path": path, "rules": len(rules)}).Info("Rules loaded")
+	}
+	for _, r := range rules {
+		err := r.compile()
+		Check(err)
+	}
+	return rules
+}
+
+func (r *Rule) compile() error {
+	if r.Name == "" {
+		return fmt.Errorf("rule without name")
+	}
+	if len(r.Actions) == 0 {
+		return fmt.Errorf("rule %q: no actions", r.Name)
+	}
+	if r.Severity == "" {
+		r.Severity = "warning"
+	}
+	if !validSeverity(r.Severity) {
+		return fmt.Errorf("rule %q: unknown severity %q", r.Name, r.Severity)
+	}
+	for class, severity := range r.ExitSeverity {
+		if !validSeverity(severity) {
+			return fmt.Errorf("rule %q: exit class %q: unknown severity %q", r.Name, class, severity)
+		}
+	}
+
+	if r.Template != "" {
+		t, err := ParseMessageTemplate(r.Name, r.Template)
+		if err != nil {
+			return fmt.Errorf("rule %q: %s", r.Name, err)
+		}
+		r.template = t
+	}
+
+	m := &r.Match
+	m.matchers = nil
+	patterns := []struct {
+		pattern string
+		field   eventField
+	}{
+		{m.Type, func(m *Event) string { return m.Type }},
+		{m.Status, func(m *Event) string { return m.Status }},
+		{m.Action, func(m *Event) string { return m.Action }},
+		{m.Image, func(m *Event) string { return m.Actor.Attributes.Image }},
+		{m.Service, func(m *Event) string { return m.Actor.Attributes.ComDockerSwarmServiceName }},
+		{m.Node, func(m *Event) string { return m.NodeID() }},
+		{m.ExitCode, func(m *Event) string { return m.Actor.Attributes.ExitCode }},
+		{m.ExitClass, func(m *Event) string { return m.ExitClass }},
+	}
+	for _, p := range patterns {
+		if err := m.add(p.pattern, p.field); err != nil {
+			return fmt.Errorf("rule %q: %s", r.Name, err)
+		}
+	}
+	for key, pattern := range m.Attributes {
+		key := key
+		if err := m.add(pattern, func(m *Event) string { return m.Actor.Attributes.Raw[key] }); err != nil {
+			return fmt.Errorf("rule %q: attribute %q: %s", r.Name, key, err)
+		}
+	}
+	return nil
+}
+
+func (m *RuleMatch) add(pattern string, field eventField) error {
+	if pattern == "" {
+		return nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	m.matchers = append(m.matchers, fieldMatcher{re: re, value: field})
+	return nil
+}
+
+// SeverityOf the notifications the rule triggers for m
+func (r *Rule) SeverityOf(m *Event) string {
+	if severity, ok := r.ExitSeverity[m.ExitClass]; ok {
+		return severity
+	}
+	return r.Severity
+}
+
+// Matches reports whether every matcher of the rule accepts m
+func (r *Rule) Matches(m *Event) bool {
+	for _, f := range r.Match.matchers {
+		if !f.re.MatchString(f.value(m)) {
+			return false
+		}
+	}
+	return true
+}
+
+func validSeverity(s string) bool {
+	return severityRank(s) >= 0
+}
+
+// severityRank position of s in Severities, -1 if unknown
+func severityRank(s string) int {
+	for i, v := range Severities {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Rule", func() {
+	at := time.Unix(1500000000, 0)
+
+	It("matches all patterns of its match", func() {
+		r := &Rule{Name: "db", Match: RuleMatch{Type: "^container$", Status: "^die$", Service: "^db"}, Actions: []string{ClassEvent}}
+		Expect(r.compile()).To(Succeed())
+		Expect(r.Matches(&Event{Type: "container", Status: "die"})).To(BeFalse())
+
+		m := containerEvent("die", "a", "db-primary.1.x", "1", at)
+		Expect(r.Matches(&m)).To(BeTrue())
+		m.Status = "start"
+		Expect(r.Matches(&m)).To(BeFalse())
+	})
+
+	It("matches raw attributes", func() {
+		r := &Rule{Name: "labelled", Match: RuleMatch{Attributes: map[string]string{"team": "^ops$"}}, Actions: []string{ClassEvent}}
+		Expect(r.compile()).To(Succeed())
+		m := containerEvent("die", "a", "s.1.x", "1", at)
+		Expect(r.Matches(&m)).To(BeFalse())
+		m.Actor.Attributes.Raw = map[string]string{"team": "ops"}
+		Expect(r.Matches(&m)).To(BeTrue())
+	})
+
+	It("defaults the severity and overrides it per exit class", func() {
+		r := &Rule{Name: "dies", Actions: []string{ClassEvent}, ExitSeverity: map[string]string{ExitOom: "critical"}}
+		Expect(r.compile()).To(Succeed())
+		Expect(r.SeverityOf(&Event{ExitClass: ExitError})).To(Equal("warning"))
+		Expect(r.SeverityOf(&Event{ExitClass: ExitOom})).To(Equal("critical"))
+	})
+
+	DescribeTable("rejects invalid rules",
+		func(r Rule, msg string) {
+			Expect(r.compile()).To(MatchError(ContainSubstring(msg)))
+		},
+		Entry("without name", Rule{Actions: []string{ClassEvent}}, "without name"),
+		Entry("without actions", Rule{Name: "r"}, "no actions"),
+		Entry("unknown severity", Rule{Name: "r", Actions: []string{ClassEvent}, Severity: "fatal"}, `unknown severity "fatal"`),
+		Entry("unknown exit severity", Rule{Name: "r", Actions: []string{ClassEvent}, ExitSeverity: map[string]string{ExitOom: "fatal"}}, `exit class "oom"`),
+		Entry("invalid pattern", Rule{Name: "r", Actions: []string{ClassEvent}, Match: RuleMatch{Status: "("}}, "missing closing )"),
+		Entry("invalid template", Rule{Name: "r", Actions: []string{ClassEvent}, Template: "{{.Nope}}"}, "Nope"),
+	)
+
+	It("compiles the default rules", func() {
+		for _, r := range DefaultRules() {
+			Expect(r.compile()).To(Succeed())
+		}
+	})
+})
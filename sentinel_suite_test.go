@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestSentinel(t *testing.T) {
+	log.SetLevel(log.ErrorLevel)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Sentinel Suite")
+}
+
+// containerEvent a Swarm container event of task in service at t
+func containerEvent(status, id, task, exitCode string, t time.Time) Event {
+	var m Event
+	m.Type = "container"
+	m.Status = status
+	m.ID = id
+	m.TimeNano = t.UnixNano()
+	a := &m.Actor.Attributes
+	a.ComDockerSwarmServiceName = strings.SplitN(task, ".", 2)[0]
+	a.ComDockerSwarmTaskName = task
+	a.ComDockerSwarmNodeID = "node1"
+	a.ExitCode = exitCode
+	return m
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Health tracks whether every event source is alive and ready, e.g. has partitions assigned
+type Health struct {
+	mu      sync.Mutex
+	sources map[string]*sourceHealth
+}
+
+type sourceHealth struct {
+	alive bool
+	ready bool
+}
+
+// health of the event sources of this process
+var health = &Health{sources: map[string]*sourceHealth{}}
+
+func (h *Health) source(name string) *sourceHealth {
+	s, ok := h.sources[name]
+	if !ok {
+		s = &sourceHealth{}
+		h.sources[name] = s
+	}
+	return s
+}
+
+func (h *Health) SetAlive(name string, alive bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.source(name)
+	s.alive = alive
+	if !alive {
+		s.ready = false
+	}
+}
+
+func (h *Health) SetReady(name string, ready bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.source(name).ready = ready
+}
+
+// Status reports whether all sources are alive and ready, with the first source that is not
+func (h *Health) Status() (alive, ready bool, failing string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.sources) == 0 {
+		return false, false, "no event source"
+	}
+	alive, ready = true, true
+	for name, s := range h.sources {
+		if !s.alive || !s.ready {
+			failing = name
+		}
+		alive = alive && s.alive
+		ready = ready && s.alive && s.ready
+	}
+	return alive, ready, failing
+}
+
+// serveHTTP exposes metrics, health checks, the swarm state of all clusters and dry run recordings on addr, it never returns
+func serveHTTP(addr string, pipelines []*Pipeline) {
+	log.WithFields(log.Fields{"addr": addr}).Info("HTTP server listening")
+	err := http.ListenAndServe(addr, newServeMux(pipelines))
+	log.WithFields(log.Fields{"addr": addr, "error": err}).Fatal("HTTP server failed")
+}
+
+func newServeMux(pipelines []*Pipeline) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		metrics.WriteTo(w)
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		alive, _, failing := health.Status()
+		writeStatus(w, alive, failing+" not running")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		_, ready, failing := health.Status()
+		writeStatus(w, ready, failing+" not ready")
+	})
+	mux.HandleFunc("/services", func(w http.ResponseWriter, r *http.Request) {
+		cluster := r.URL.Query().Get("cluster")
+		summaries := []ServiceSummary{}
+		for _, p := range pipelines {
+			if cluster == "" || cluster == p.Cluster {
+				summaries = append(summaries, p.State.Services(r.URL.Query().Get("broken") == "true")...)
+			}
+		}
+		writeJSON(w, summaries)
+	})
+	mux.HandleFunc("/incidents", func(w http.ResponseWriter, r *http.Request) {
+		incidents := []Incident{}
+		for _, p := range pipelines {
+			incidents = append(incidents, p.Incidents.Open()...)
+		}
+		writeJSON(w, incidents)
+	})
+	mux.HandleFunc("/services/", func(w http.ResponseWriter, r *http.Request) {
+		cluster := r.URL.Query().Get("cluster")
+		for _, p := range pipelines {
+			if cluster != "" && cluster != p.Cluster {
+				continue
+			}
+			if service, ok := p.State.Service(strings.TrimPrefix(r.URL.Path, "/services/")); ok {
+				writeJSON(w, service)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/dry-run", func(w http.ResponseWriter, r *http.Request) {
+		recorder := pipelines[0].Dispatcher.Recorder
+		if recorder == nil {
+			http.Error(w, "not running with --dry-run", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, recorder.Recordings())
+	})
+	return mux
+}
+
+func writeStatus(w http.ResponseWriter, ok bool, reason string) {
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, reason)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.WithFields(log.Fields{"error": err}).Warn("HTTP response failed")
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HTTP API", func() {
+	var server *httptest.Server
+
+	BeforeEach(func() {
+		at := time.Unix(1500000000, 0)
+		prod, staging := &Pipeline{Cluster: "prod", State: NewSwarmState("prod")}, &Pipeline{Cluster: "staging", State: NewSwarmState("staging")}
+		prod.State.Observe(containerEvent("start", "a", "db.1.x", "", at))
+		m := containerEvent("die", "a", "db.1.x", "1", at.Add(time.Minute))
+		m.ExitClass = ExitError
+		prod.State.Observe(m)
+		prod.State.Observe(containerEvent("start", "b", "web.1.x", "", at))
+		staging.State.Observe(containerEvent("start", "c", "db.1.x", "", at))
+		server = httptest.NewServer(newServeMux([]*Pipeline{prod, staging}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	get := func(path string, v interface{}) int {
+		res, err := http.Get(server.URL + path)
+		Expect(err).NotTo(HaveOccurred())
+		defer res.Body.Close()
+		if res.StatusCode == http.StatusOK {
+			Expect(res.Header.Get("Content-Type")).To(Equal("application/json"))
+			Expect(json.NewDecoder(res.Body).Decode(v)).To(Succeed())
+		}
+		return res.StatusCode
+	}
+
+	It("lists the services of all clusters", func() {
+		var services []ServiceSummary
+		Expect(get("/services", &services)).To(Equal(http.StatusOK))
+		Expect(services).To(HaveLen(3))
+	})
+
+	It("filters services by cluster and brokenness", func() {
+		var services []ServiceSummary
+		Expect(get("/services?cluster=prod", &services)).To(Equal(http.StatusOK))
+		Expect(services).To(HaveLen(2))
+
+		services = nil
+		Expect(get("/services?broken=true", &services)).To(Equal(http.StatusOK))
+		Expect(services).To(HaveLen(1))
+		Expect(services[0].Cluster).To(Equal("prod"))
+		Expect(services[0].Name).To(Equal("db"))
+		Expect(services[0].Broken).To(BeTrue())
+	})
+
+	It("shows the tasks of a service", func() {
+		var service ServiceState
+		Expect(get("/services/db?cluster=staging", &service)).To(Equal(http.StatusOK))
+		Expect(service.Cluster).To(Equal("staging"))
+		Expect(service.Tasks["1"].State).To(Equal(TaskRunning))
+		Expect(get("/services/nope", nil)).To(Equal(http.StatusNotFound))
+	})
+})
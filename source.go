@@ -0,0 +1,28 @@
+package main
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// EventSource delivers decoded Docker events to handle until the source ends
+type EventSource interface {
+	Name() string
+	Run(handle func(m Event) error) error
+}
+
+// instrumented wraps the pipeline handler with the metrics shared by all event sources
+func instrumented(pipeline *Pipeline) func(m Event) error {
+	return func(m Event) error {
+		start := time.Now()
+		metrics.Inc("sentinel_events_consumed_total", Labels{"type": m.Type, "status": m.Status})
+		err := pipeline.Handle(m)
+		metrics.Observe("sentinel_handler_duration_seconds", nil, time.Since(start).Seconds())
+		metrics.Set("sentinel_last_event_timestamp_seconds", nil, float64(eventTime(m).UnixNano())/1e9)
+		if err != nil {
+			log.WithFields(log.Fields{"status": m.Status, "id": m.ID, "error": err}).Error("Event handling failed")
+		}
+		return err
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// DockerSource streams /events straight from a Docker daemon, e.g. unix:///var/run/docker.sock
+// or tcp://127.0.0.1:2375. After a lost connection it resumes from the last event seen.
+type DockerSource struct {
+	Host string
+
+	client  *http.Client
+	baseURL string
+}
+
+func NewDockerSource(host string) (*DockerSource, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, err
+	}
+	s := &DockerSource{Host: host}
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		s.client = &http.Client{Transport: &http.Transport{
+			Dial: func(network, addr string) (net.Conn, error) {
+				return net.Dial("unix", socket)
+			},
+		}}
+		s.baseURL = "http://docker"
+	case "tcp", "http":
+		s.client = &http.Client{}
+		s.baseURL = "http://" + u.Host
+	case "https":
+		s.client = &http.Client{}
+		s.baseURL = "https://" + u.Host
+	default:
+		return nil, fmt.Errorf("docker host %q: unsupported scheme %q", host, u.Scheme)
+	}
+	return s, nil
+}
+
+func (s *DockerSource) Name() string {
+	return "docker"
+}
+
+// Run reconnects forever, it only returns if the daemon rejects the request with a 4xx
+func (s *DockerSource) Run(handle func(m Event) error) error {
+	var since int64
+	for {
+		last, err := s.stream(since, handle)
+		if last > 0 {
+			since = last
+		}
+		health.SetAlive(s.Name(), false)
+		if _, ok := err.(rejectedError); ok {
+			return err
+		}
+		log.WithFields(log.Fields{"host": s.Host, "error": err}).Warn("Docker events stream lost, reconnecting")
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// rejectedError the daemon answered, but refused to stream events
+type rejectedError struct {
+	error
+}
+
+// stream handles events until the connection ends, it returns the timeNano of the last event
+func (s *DockerSource) stream(since int64, handle func(m Event) error) (int64, error) {
+	u := s.baseURL + "/events"
+	if since > 0 {
+		u += "?since=" + strconv.FormatInt(since/1e9, 10) + "." + fmt.Sprintf("%09d", since%1e9)
+	}
+	res, err := s.client.Get(u)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 400 && res.StatusCode < 500 {
+		return 0, rejectedError{fmt.Errorf("docker %s: %s", u, res.Status)}
+	}
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("docker %s: %s", u, res.Status)
+	}
+	health.SetAlive(s.Name(), true)
+	health.SetReady(s.Name(), true)
+	log.WithFields(log.Fields{"host": s.Host, "since": since}).Info("Streaming Docker events")
+
+	var last int64
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var m Event
+		if err := json.Unmarshal(line, &m); err != nil {
+			metrics.Inc("sentinel_dead_letters_total", Labels{"reason": "decode"})
+			log.WithFields(log.Fields{"host": s.Host, "line": string(line), "error": err}).Warn("Docker: skipping undecodable event")
+			continue
+		}
+		log.WithFields(log.Fields{"host": s.Host, "event": m}).Debug("Docker Event")
+		if err := handle(m); err != nil {
+			// resume with this event once reconnected
+			return last, err
+		}
+		if m.TimeNano > 0 {
+			// since is inclusive, skip past the last event on resume
+			last = m.TimeNano + 1
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return last, err
+	}
+	return last, fmt.Errorf("stream closed")
+}
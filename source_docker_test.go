@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DockerSource", func() {
+	var (
+		server   *httptest.Server
+		queries  []string
+		source   *DockerSource
+		received []Event
+		handle   func(m Event) error
+	)
+
+	BeforeEach(func() {
+		queries = nil
+		received = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.URL.Path).To(Equal("/events"))
+			queries = append(queries, r.URL.RawQuery)
+			fmt.Fprintln(w, `{"status":"start","id":"a","Type":"container","timeNano":1000000000}`)
+			fmt.Fprintln(w, `{"status":`)
+			fmt.Fprintln(w, `{"status":"die","id":"a","Type":"container","timeNano":2000000005}`)
+		}))
+		var err error
+		source, err = NewDockerSource(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		handle = func(m Event) error {
+			received = append(received, m)
+			return nil
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("streams events, skipping undecodable ones", func() {
+		last, err := source.stream(0, handle)
+		Expect(err).To(MatchError("stream closed"))
+		Expect(received).To(HaveLen(2))
+		Expect(received[0].Status).To(Equal("start"))
+		Expect(received[1].Status).To(Equal("die"))
+		Expect(last).To(Equal(int64(2000000006)))
+		Expect(queries).To(Equal([]string{""}))
+	})
+
+	It("resumes after the last event", func() {
+		_, err := source.stream(2000000006, handle)
+		Expect(err).To(MatchError("stream closed"))
+		Expect(queries).To(Equal([]string{"since=2.000000006"}))
+	})
+
+	It("resumes with an event that could not be handled", func() {
+		failing := func(m Event) error {
+			if m.Status == "die" {
+				return fmt.Errorf("outbox full")
+			}
+			return nil
+		}
+		last, err := source.stream(0, failing)
+		Expect(err).To(MatchError("outbox full"))
+		Expect(last).To(Equal(int64(1000000001)))
+	})
+
+	It("gives up when the daemon rejects the request", func() {
+		server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "client version too old", http.StatusBadRequest)
+		})
+		err := source.Run(handle)
+		Expect(err).To(BeAssignableToTypeOf(rejectedError{}))
+	})
+})
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// ReplaySource feeds recorded Docker events, one JSON object per line, through the pipeline.
+// With a Speed above zero the original timeNano spacing is kept, divided by Speed,
+// otherwise events are replayed as fast as possible.
+type ReplaySource struct {
+	File  string // "-" reads stdin
+	Speed float64
+}
+
+// ParseSpeed parses a replay speed like "10x", "0.5" or "max"
+func ParseSpeed(s string) (float64, error) {
+	s = strings.ToLower(s)
+	if s == "max" || s == "" {
+		return 0, nil
+	}
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(s, "x"), 64)
+	if err != nil || speed < 0 {
+		return 0, fmt.Errorf("invalid replay speed %q", s)
+	}
+	return speed, nil
+}
+
+func (s *ReplaySource) Name() string {
+	return "replay"
+}
+
+func (s *ReplaySource) Run(handle func(m Event) error) error {
+	var r io.Reader = os.Stdin
+	if s.File != "-" && s.File != "" {
+		f, err := os.Open(s.File)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	health.SetAlive(s.Name(), true)
+	health.SetReady(s.Name(), true)
+	defer health.SetAlive(s.Name(), false)
+
+	var previous int64
+	lines, events := 0, 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		lines++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var m Event
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			metrics.Inc("sentinel_dead_letters_total", Labels{"reason": "decode"})
+			log.WithFields(log.Fields{"file": s.File, "line": lines, "error": err}).Warn("Replay: skipping undecodable line")
+			continue
+		}
+		if s.Speed > 0 && previous > 0 && m.TimeNano > previous {
+			time.Sleep(time.Duration(float64(m.TimeNano-previous) / s.Speed))
+		}
+		if m.TimeNano > 0 {
+			previous = m.TimeNano
+		}
+		events++
+		if err := handle(m); err != nil {
+			return fmt.Errorf("replay %s:%d: %s", s.File, lines, err)
+		}
+	}
+	log.WithFields(log.Fields{"file": s.File, "events": events}).Info("Replay done")
+	return scanner.Err()
+}
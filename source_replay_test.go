@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ReplaySource", func() {
+	DescribeTable("ParseSpeed",
+		func(s string, speed float64) {
+			Expect(ParseSpeed(s)).To(Equal(speed))
+		},
+		Entry("max", "max", 0.0),
+		Entry("MAX", "MAX", 0.0),
+		Entry("empty", "", 0.0),
+		Entry("factor", "10x", 10.0),
+		Entry("fraction", "0.5", 0.5),
+	)
+
+	It("rejects invalid speeds", func() {
+		_, err := ParseSpeed("fast")
+		Expect(err).To(HaveOccurred())
+		_, err = ParseSpeed("-2x")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("feeds every decodable line to handle", func() {
+		f, err := ioutil.TempFile("", "sentinel-replay")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.Remove(f.Name())
+		f.WriteString(`{"status":"start","id":"a","Type":"container","timeNano":1}` + "\n\ngarbage\n" + `{"status":"die","id":"a","Type":"container","timeNano":2}` + "\n")
+		f.Close()
+
+		var statuses []string
+		err = (&ReplaySource{File: f.Name()}).Run(func(m Event) error {
+			statuses = append(statuses, m.Status)
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statuses).To(Equal([]string{"start", "die"}))
+	})
+})
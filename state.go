@@ -0,0 +1,265 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/larskluge/babl-server/utils"
+	bn "github.com/larskluge/babl/bablnaming"
+)
+
+// Task states kept by SwarmState
+const (
+	TaskRunning = "running"
+	TaskExited  = "exited"
+)
+
+// exitedTaskTTL after which the slot of an exited task not replaced by a new one is forgotten,
+// e.g. after a scale-down; Swarm replaces failed tasks well within it
+const exitedTaskTTL = 15 * time.Minute
+
+// SwarmState live model of the tasks of every Swarm service, learned from container events
+type SwarmState struct {
+	Cluster  string
+	mu       sync.RWMutex
+	services map[string]*ServiceState
+}
+
+// ServiceState tasks of one service keyed by slot, global services are keyed by node id
+type ServiceState struct {
+	Cluster  string                `json:"cluster"`
+	Name     string                `json:"name"`
+	Module   string                `json:"module"`
+	Tasks    map[string]*TaskState `json:"tasks"`
+	Restarts int                   `json:"restarts"`
+	Updated  time.Time             `json:"updated"`
+}
+
+// TaskState current state of the task occupying a slot
+type TaskState struct {
+	Slot           string    `json:"slot"`
+	TaskID         string    `json:"task_id"`
+	ContainerID    string    `json:"container_id"`
+	Node           string    `json:"node"`
+	Image          string    `json:"image"`
+	State          string    `json:"state"`
+	ExitCode       string    `json:"exit_code,omitempty"`
+	ExitClass      string    `json:"exit_class,omitempty"`
+	LastTransition time.Time `json:"last_transition"`
+	Started        time.Time `json:"started,omitempty"`
+	Restarts       int       `json:"restarts"`
+}
+
+// ServiceSummary condensed view of a service as listed by GET /services
+type ServiceSummary struct {
+	Cluster  string    `json:"cluster"`
+	Name     string    `json:"name"`
+	Module   string    `json:"module"`
+	Tasks    int       `json:"tasks"`
+	Running  int       `json:"running"`
+	Restarts int       `json:"restarts"`
+	Broken   bool      `json:"broken"`
+	Updated  time.Time `json:"updated"`
+}
+
+func NewSwarmState(cluster string) *SwarmState {
+	return &SwarmState{Cluster: cluster, services: map[string]*ServiceState{}}
+}
+
+// Observe applies the container event m to the task of its slot
+func (s *SwarmState) Observe(m Event) {
+	a := m.Actor.Attributes
+	if m.Type != "container" || a.ComDockerSwarmServiceName == "" {
+		return
+	}
+	now := eventTime(m)
+	slot := taskSlot(a.ComDockerSwarmServiceName, a.ComDockerSwarmTaskName, a.ComDockerSwarmNodeID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	service, ok := s.services[a.ComDockerSwarmServiceName]
+	if !ok {
+		service = &ServiceState{Cluster: s.Cluster, Name: a.ComDockerSwarmServiceName, Module: bn.ServiceToModule(a.ComDockerSwarmServiceName), Tasks: map[string]*TaskState{}}
+		s.services[service.Name] = service
+	}
+	task, ok := service.Tasks[slot]
+	if !ok {
+		task = &TaskState{Slot: slot}
+		service.Tasks[slot] = task
+	}
+	if a.ComDockerSwarmTaskID != "" {
+		task.TaskID = a.ComDockerSwarmTaskID
+	}
+	task.ContainerID = m.ID
+	if a.ComDockerSwarmNodeID != "" {
+		task.Node = a.ComDockerSwarmNodeID
+	}
+	if a.Image != "" {
+		task.Image = a.Image
+	}
+
+	switch m.Status {
+	case "start":
+		if !task.Started.IsZero() {
+			task.Restarts++
+			service.Restarts++
+		}
+		task.State = TaskRunning
+		task.Started = now
+		task.ExitCode = ""
+		task.ExitClass = ""
+	case "die":
+		task.State = TaskExited
+		task.ExitCode = a.ExitCode
+		task.ExitClass = m.ExitClass
+	case "oom":
+		task.ExitClass = ExitOom
+		return
+	default:
+		return
+	}
+	task.LastTransition = now
+	service.Updated = now
+}
+
+// Uptime how long the container of m had been running by the time of m, zero if its start is unknown
+func (s *SwarmState) Uptime(m Event) time.Duration {
+	a := m.Actor.Attributes
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	service, ok := s.services[a.ComDockerSwarmServiceName]
+	if !ok {
+		return 0
+	}
+	task, ok := service.Tasks[taskSlot(a.ComDockerSwarmServiceName, a.ComDockerSwarmTaskName, a.ComDockerSwarmNodeID)]
+	if !ok || task.ContainerID != m.ID || task.Started.IsZero() {
+		return 0
+	}
+	return eventTime(m).Sub(task.Started)
+}
+
+// RunningSince reports whether service has tasks running and none failed, with the latest start of its tasks
+func (s *SwarmState) RunningSince(name string) (time.Time, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	service, ok := s.services[name]
+	if !ok {
+		return time.Time{}, false
+	}
+	var since time.Time
+	running := false
+	for _, task := range service.Tasks {
+		switch {
+		case task.State == TaskRunning:
+			running = true
+			if task.Started.After(since) {
+				since = task.Started
+			}
+		case Failed(task.ExitClass):
+			return time.Time{}, false
+		}
+	}
+	return since, running
+}
+
+// Broken reports whether a task of the named service failed and has not been replaced yet
+func (s *SwarmState) Broken(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	service, ok := s.services[name]
+	return ok && service.summary().Broken
+}
+
+// Expire forgets the slots of tasks exited for exitedTaskTTL at now, and services without slots
+func (s *SwarmState) Expire(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, service := range s.services {
+		for slot, task := range service.Tasks {
+			if task.State == TaskExited && now.Sub(task.LastTransition) >= exitedTaskTTL {
+				delete(service.Tasks, slot)
+			}
+		}
+		if len(service.Tasks) == 0 {
+			delete(s.services, name)
+		}
+	}
+}
+
+// Services summaries of all known services sorted by name, optionally only the broken ones
+func (s *SwarmState) Services(brokenOnly bool) []ServiceSummary {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	summaries := []ServiceSummary{}
+	for _, service := range s.services {
+		summary := service.summary()
+		if brokenOnly && !summary.Broken {
+			continue
+		}
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Name < summaries[j].Name })
+	return summaries
+}
+
+// Service a copy of the state of the named service
+func (s *SwarmState) Service(name string) (ServiceState, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	service, ok := s.services[name]
+	if !ok {
+		return ServiceState{}, false
+	}
+	c := *service
+	c.Tasks = make(map[string]*TaskState, len(service.Tasks))
+	for slot, task := range service.Tasks {
+		t := *task
+		c.Tasks[slot] = &t
+	}
+	return c, true
+}
+
+// ServicesOnNode services with tasks currently running on node, sorted by name
+func (s *SwarmState) ServicesOnNode(node string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var services []string
+	for name, service := range s.services {
+		for _, task := range service.Tasks {
+			if task.Node == node && task.State == TaskRunning {
+				services = append(services, name)
+				break
+			}
+		}
+	}
+	sort.Strings(services)
+	return services
+}
+
+func (service *ServiceState) summary() ServiceSummary {
+	summary := ServiceSummary{Cluster: service.Cluster, Name: service.Name, Module: service.Module, Tasks: len(service.Tasks), Restarts: service.Restarts, Updated: service.Updated}
+	for _, task := range service.Tasks {
+		if task.State == TaskRunning {
+			summary.Running++
+		} else if Failed(task.ExitClass) {
+			summary.Broken = true
+		}
+	}
+	return summary
+}
+
+// taskSlot parses the slot from a task name like "service.3.taskid", global services use the node id
+func taskSlot(service, taskName, node string) string {
+	rest := strings.TrimPrefix(taskName, service+".")
+	if rest == taskName || rest == "" {
+		return node
+	}
+	slot := SplitFirst(rest, ".")
+	if _, err := strconv.Atoi(slot); err != nil {
+		return node
+	}
+	return slot
+}
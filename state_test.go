@@ -0,0 +1,104 @@
+package main
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SwarmState", func() {
+	var (
+		s  *SwarmState
+		at time.Time
+	)
+
+	BeforeEach(func() {
+		s = NewSwarmState("prod")
+		at = time.Unix(1500000000, 0)
+	})
+
+	die := func(id, task, exitCode, exitClass string, at time.Time) Event {
+		m := containerEvent("die", id, task, exitCode, at)
+		m.ExitClass = exitClass
+		return m
+	}
+
+	DescribeTable("taskSlot",
+		func(service, task, node, slot string) {
+			Expect(taskSlot(service, task, node)).To(Equal(slot))
+		},
+		Entry("replicated", "db", "db.3.xyz", "node1", "3"),
+		Entry("global", "agent", "agent.node1.xyz", "node1", "node1"),
+		Entry("without task name", "db", "", "node1", "node1"),
+		Entry("other service", "db", "web.1.xyz", "node1", "node1"),
+	)
+
+	It("counts a restart when a slot starts again after a die", func() {
+		s.Observe(containerEvent("start", "a", "db.1.x", "", at))
+		s.Observe(die("a", "db.1.x", "1", ExitError, at.Add(time.Minute)))
+		Expect(s.Broken("db")).To(BeTrue())
+		Expect(s.Uptime(die("a", "db.1.x", "1", ExitError, at.Add(time.Minute)))).To(Equal(time.Minute))
+
+		s.Observe(containerEvent("start", "b", "db.1.y", "", at.Add(2*time.Minute)))
+		service, ok := s.Service("db")
+		Expect(ok).To(BeTrue())
+		Expect(service.Tasks).To(HaveLen(1))
+		task := service.Tasks["1"]
+		Expect(task.State).To(Equal(TaskRunning))
+		Expect(task.ContainerID).To(Equal("b"))
+		Expect(task.Restarts).To(Equal(1))
+		Expect(task.ExitClass).To(BeEmpty())
+		Expect(service.Restarts).To(Equal(1))
+		Expect(s.Broken("db")).To(BeFalse())
+
+		since, running := s.RunningSince("db")
+		Expect(running).To(BeTrue())
+		Expect(since).To(Equal(at.Add(2 * time.Minute)))
+	})
+
+	It("keys the tasks of global services by node", func() {
+		for _, node := range []string{"node1", "node2"} {
+			m := containerEvent("start", "c-"+node, "agent."+node+".x", "", at)
+			m.Actor.Attributes.ComDockerSwarmNodeID = node
+			s.Observe(m)
+		}
+		service, _ := s.Service("agent")
+		Expect(service.Tasks).To(HaveKey("node1"))
+		Expect(service.Tasks).To(HaveKey("node2"))
+		Expect(service.Tasks["node2"].Node).To(Equal("node2"))
+		Expect(s.ServicesOnNode("node2")).To(Equal([]string{"agent"}))
+	})
+
+	It("lists only broken services when asked to", func() {
+		s.Observe(containerEvent("start", "a", "db.1.x", "", at))
+		s.Observe(die("a", "db.1.x", "137", ExitOom, at.Add(time.Minute)))
+		s.Observe(containerEvent("start", "b", "web.1.x", "", at))
+		s.Observe(containerEvent("start", "c", "worker.1.x", "", at))
+		s.Observe(die("c", "worker.1.x", "143", ExitSigterm, at.Add(time.Minute)))
+
+		Expect(s.Services(false)).To(HaveLen(3))
+		broken := s.Services(true)
+		Expect(broken).To(HaveLen(1))
+		Expect(broken[0].Name).To(Equal("db"))
+		Expect(broken[0].Running).To(Equal(0))
+	})
+
+	It("forgets exited slots after exitedTaskTTL, and services without slots", func() {
+		s.Observe(containerEvent("start", "a", "db.1.x", "", at))
+		s.Observe(containerEvent("start", "b", "db.2.x", "", at))
+		s.Observe(die("b", "db.2.x", "0", ExitClean, at.Add(time.Minute)))
+		s.Observe(containerEvent("start", "c", "web.1.x", "", at))
+		s.Observe(die("c", "web.1.x", "0", ExitClean, at.Add(time.Minute)))
+
+		s.Expire(at.Add(time.Minute + exitedTaskTTL - time.Second))
+		Expect(s.Services(false)).To(HaveLen(2))
+		s.Expire(at.Add(time.Minute + exitedTaskTTL))
+		service, ok := s.Service("db")
+		Expect(ok).To(BeTrue())
+		Expect(service.Tasks).To(HaveLen(1))
+		_, ok = s.Service("web")
+		Expect(ok).To(BeFalse())
+	})
+})